@@ -0,0 +1,117 @@
+package buffer
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackgroundWriter writes dirty, unpinned buffers to disk ahead of their eviction,
+// so that transactions pinning a block seldom wait for the write of the page it replaces.
+// Like an eviction, a write first flushes the log up to the page's LSN.
+type BackgroundWriter struct {
+	bm       *BufferMgr
+	interval time.Duration
+	batch    int
+	next     int // position of the sweep in the pool
+	stop     chan struct{}
+	done     chan struct{}
+	err      error // first write error
+}
+
+// StartBackgroundWriter starts a goroutine that writes up to batch dirty buffers every interval,
+// sweeping the pool. It runs until Stop is called.
+func (bm *BufferMgr) StartBackgroundWriter(interval time.Duration, batch int) *BackgroundWriter {
+	w := &BackgroundWriter{
+		bm:       bm,
+		interval: interval,
+		batch:    batch,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *BackgroundWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if _, err := w.writeDirty(); err != nil {
+				if w.err == nil {
+					w.err = err
+				}
+				fmt.Printf("warning: background writer: %v\n", err)
+			}
+		}
+	}
+}
+
+// Stop stops the writer and waits for its current batch to be written.
+// Returns the first error the writer ran into, if any.
+func (w *BackgroundWriter) Stop() error {
+	close(w.stop)
+	<-w.done
+	return w.err
+}
+
+// writeDirty writes the next dirty, unpinned buffers of the pool, up to the batch size,
+// and syncs their files. Returns the number of buffers written.
+// The buffers are picked with the buffer manager locked, then pinned and marked
+// as loading while they are written, without the lock: pins of their blocks wait
+// for the write, so that the pages can't be modified while they are written,
+// and the rest of the pool stays usable meanwhile.
+func (w *BackgroundWriter) writeDirty() (int, error) {
+	bm := w.bm
+	var picked []*Buffer
+	bm.mu.Lock()
+	for scanned := 0; scanned < len(bm.bufferpool) && len(picked) < w.batch; scanned++ {
+		b := bm.bufferpool[w.next]
+		w.next = (w.next + 1) % len(bm.bufferpool)
+		if !b.IsPinned() && b.ModifyingTx() >= 0 {
+			b.loading = make(chan struct{})
+			b.Pin()
+			bm.numAvailable--
+			picked = append(picked, b)
+		}
+	}
+	bm.mu.Unlock()
+
+	written := 0
+	files := make(map[string]bool)
+	var err error
+	for _, b := range picked {
+		filename := b.Block().Filename
+		// scans of the pool lock each buffer: it isn't kept locked while the log is flushed
+		if err = b.flushLog(); err != nil {
+			break
+		}
+		if err = b.Flush(); err != nil {
+			break
+		}
+		files[filename] = true
+		written++
+	}
+
+	bm.mu.Lock()
+	for _, b := range picked {
+		close(b.loading)
+		b.loading = nil
+		bm.unpin(b)
+	}
+	bm.stats.DirtyFlushes += int64(written)
+	bm.mu.Unlock()
+	if err != nil {
+		return written, fmt.Errorf("writing buffer: %w", err)
+	}
+	for filename := range files {
+		if err := bm.fm.Sync(filename); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,104 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+)
+
+func TestBackgroundWriter(t *testing.T) {
+	fm, lm := newTestMgrs(t, 3)
+	bm := NewBufferMgr(fm, lm, 3)
+
+	// two dirty buffers, one of them still pinned
+	var buffs []*Buffer
+	for i := 0; i < 2; i++ {
+		blk := file.NewBlockId("testfile", i)
+		buff, err := bm.Pin(blk)
+		if err != nil {
+			t.Fatalf("Pin(%v): %v", blk, err)
+		}
+		lsn, err := lm.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		buff.Contents().SetInt(0, 42+i)
+		buff.SetModified(1, lsn)
+		buffs = append(buffs, buff)
+	}
+	bm.Unpin(buffs[0])
+
+	w := bm.StartBackgroundWriter(time.Millisecond, 1)
+	deadline := time.Now().Add(time.Second)
+	for buffs[0].ModifyingTx() >= 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("background writer didn't write the unpinned buffer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if buffs[1].ModifyingTx() < 0 {
+		t.Errorf("background writer wrote a pinned buffer")
+	}
+	// the WAL rule: the log was flushed up to the page's LSN before the page was written
+	if lm.FlushedLSN() < buffs[0].lsn {
+		t.Errorf("page with LSN %d written before the log was flushed, up to LSN %d", buffs[0].lsn, lm.FlushedLSN())
+	}
+	p := file.NewPage(128)
+	if err := fm.Read(file.NewBlockId("testfile", 0), p); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if v, _ := p.GetInt(0); v != 42 {
+		t.Errorf("block 0 holds %v, expected 42", v)
+	}
+}
+
+func TestBackgroundWriterPinsDuringWrite(t *testing.T) {
+	// every flush of the log waits for the group commit window
+	window := 300 * time.Millisecond
+	fm, lm := newTestMgrs(t, 2, log.WithGroupCommit(window, 0))
+	bm := NewBufferMgr(fm, lm, 3)
+	blk0 := file.NewBlockId("testfile", 0)
+	buff, err := bm.Pin(blk0)
+	if err != nil {
+		t.Fatalf("Pin(%v): %v", blk0, err)
+	}
+	lsn, err := lm.Append([]byte{0})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	buff.Contents().SetInt(0, 42)
+	buff.SetModified(1, lsn)
+	bm.Unpin(buff)
+
+	w := bm.StartBackgroundWriter(time.Millisecond, 1)
+	defer w.Stop()
+	time.Sleep(50 * time.Millisecond) // the writer is flushing the log
+
+	// other blocks can be pinned while the page is written
+	start := time.Now()
+	blk1 := file.NewBlockId("testfile", 1)
+	other, err := bm.Pin(blk1)
+	if err != nil {
+		t.Fatalf("Pin(%v): %v", blk1, err)
+	}
+	if elapsed := time.Since(start); elapsed > window/2 {
+		t.Errorf("pinning another block took %v while a page was written", elapsed)
+	}
+	bm.Unpin(other)
+
+	// the block being written is pinned once it is written
+	buff, err = bm.Pin(blk0)
+	if err != nil {
+		t.Fatalf("Pin(%v): %v", blk0, err)
+	}
+	if buff.ModifyingTx() >= 0 {
+		t.Errorf("block pinned while its page was being written")
+	}
+	bm.Unpin(buff)
+}
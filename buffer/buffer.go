@@ -16,6 +16,10 @@ type Buffer struct {
 	pins     int
 	txnum    int
 	lsn      int // lsn of the most recent related log record
+	index    int // position in the buffer pool
+	// guarded by the BufferMgr
+	loading chan struct{} // closed once the block being read ahead, or written by the background writer, can be pinned
+	ring    *Ring         // ring the block was read into, if no other pin used it since
 	sync.Mutex
 }
 
@@ -66,35 +70,79 @@ func (b *Buffer) ModifyingTx() int {
 
 // AssignToBlock reads the contents of the specified block into the buffer.
 // If the buffer was dirty, its previous contents are first written to disk.
+// If the block cannot be read, the buffer is left unassigned and the error is returned.
 func (b *Buffer) AssignToBlock(blk *file.BlockId) error {
 	b.Lock()
 	defer b.Unlock()
-	b.Flush()
-	b.blk = blk
-	err := b.fm.Read(b.blk, b.contents)
+	// the evicted page must be durable: the transaction that modified it
+	// won't find it in the pool when it commits.
+	flushed, err := b.flush()
 	if err != nil {
 		return err
 	}
+	if flushed {
+		if err := b.fm.Sync(b.blk.Filename); err != nil {
+			return err
+		}
+	}
+	b.blk = nil
 	b.pins = 0
+	if err := b.fm.Read(blk, b.contents); err != nil {
+		return err
+	}
+	b.blk = blk
+	return nil
+}
+
+// read reads blk into the buffer, which must be clean.
+// If the block cannot be read, the buffer is left unassigned and the error is returned.
+func (b *Buffer) read(blk *file.BlockId) error {
+	b.Lock()
+	defer b.Unlock()
+	b.blk = nil
+	if err := b.fm.Read(blk, b.contents); err != nil {
+		return err
+	}
+	b.blk = blk
 	return nil
 }
 
 // Flush writes the buffer to its disk block if it is dirty.
+// The write becomes durable once the block's file is synced.
 func (b *Buffer) Flush() error {
-	if b.txnum >= 0 {
-		// flush log record first
-		err := b.lm.Flush(b.lsn)
-		if err != nil {
-			return err
-		}
-		// flush page
-		err = b.fm.Write(b.blk, b.contents)
-		if err != nil {
-			return err
-		}
-		b.txnum = -1
+	b.Lock()
+	defer b.Unlock()
+	_, err := b.flush()
+	return err
+}
+
+// flush is Flush, also reporting whether the page was written.
+// The buffer must be locked.
+func (b *Buffer) flush() (bool, error) {
+	if b.txnum < 0 {
+		return false, nil
 	}
-	return nil
+	// flush log record first
+	err := b.lm.Flush(b.lsn)
+	if err != nil {
+		return false, err
+	}
+	// flush page
+	err = b.fm.Write(b.blk, b.contents)
+	if err != nil {
+		return false, err
+	}
+	b.txnum = -1
+	return true, nil
+}
+
+// flushLog flushes the log up to the page's LSN, without keeping the buffer locked
+// while the log is written. The buffer must be pinned by its caller.
+func (b *Buffer) flushLog() error {
+	b.Lock()
+	lsn := b.lsn
+	b.Unlock()
+	return b.lm.Flush(lsn)
 }
 
 // Pin increases the buffer's pin count.
@@ -1,118 +1,282 @@
 package buffer
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/log"
-	"github.com/viney-shih/go-lock"
 )
 
+// MAX_TIME is how long Pin waits for a buffer to become available, unless WithPinTimeout is used.
 const MAX_TIME = 3 * time.Second
 
+// ErrBufferAbort is returned when no buffer became available to pin a block in time.
+// The caller, typically a transaction, should abort and can be retried later.
+var ErrBufferAbort = errors.New("no buffer available")
+
 type BufferMgr struct {
+	fm           *file.FileMgr
 	bufferpool   []*Buffer
+	buffers      map[file.BlockId]*Buffer // buffer assigned to each block in the pool
 	numAvailable int
-	mu           *lock.CASMutex
+	policy       ReplacementPolicy
+	timeout      time.Duration
+	unpinned     chan struct{} // closed, and replaced, when a buffer becomes unpinned
+	stats        Stats
+	waiters      int // pins waiting for a buffer to become available
+	fresh        int // buffers before fresh in the pool were assigned a block
+	readAhead    *readAhead
+	prefetched   map[*Buffer]bool // unpinned buffers holding a block read ahead that wasn't pinned since
+	prefetching  sync.WaitGroup
+	mu           sync.Mutex // guards the pool, its counters and numAvailable
 }
 
 // Creates a buffer manager having the specified number
 // of buffer slots.
-func NewBufferMgr(fm *file.FileMgr, lm *log.LogMgr, numbuffs int) *BufferMgr {
+func NewBufferMgr(fm *file.FileMgr, lm *log.LogMgr, numbuffs int, opts ...Option) *BufferMgr {
 	bufferpool := make([]*Buffer, numbuffs)
 	for i := 0; i < numbuffs; i++ {
 		bufferpool[i] = NewBuffer(fm, lm)
+		bufferpool[i].index = i
 	}
 	bm := &BufferMgr{
+		fm:           fm,
 		bufferpool:   bufferpool,
+		buffers:      make(map[file.BlockId]*Buffer, numbuffs),
 		numAvailable: numbuffs,
-		mu:           lock.NewCASMutex(),
+		policy:       FirstUnpinned(numbuffs),
+		timeout:      MAX_TIME,
+		unpinned:     make(chan struct{}),
+		prefetched:   make(map[*Buffer]bool),
+	}
+	for _, opt := range opts {
+		opt(bm)
 	}
-	// bm.cond = sync.NewCond(&bm.mu)
 	return bm
 }
 
+// WithPinTimeout sets how long Pin waits for a buffer to become available.
+func WithPinTimeout(timeout time.Duration) Option {
+	return func(bm *BufferMgr) {
+		bm.timeout = timeout
+	}
+}
+
+// Size returns the number of buffers of the pool.
+func (bm *BufferMgr) Size() int {
+	return len(bm.bufferpool)
+}
+
+// PinTimeout returns how long Pin waits for a buffer to become available.
+func (bm *BufferMgr) PinTimeout() time.Duration {
+	return bm.timeout
+}
+
+// Available returns the number of unpinned buffers.
+func (bm *BufferMgr) Available() int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.numAvailable
+}
+
 // FlushAll flushes the dirty buffers modified by the specified transaction.
-func (bm *BufferMgr) FlushAll(txnum int) {
+// Every file written to is synced once, after all of its pages have been written.
+func (bm *BufferMgr) FlushAll(txnum int) error {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
+	written := make(map[string]bool)
 	for _, buff := range bm.bufferpool {
 		if buff.ModifyingTx() == txnum {
-			buff.Flush()
+			filename := buff.Block().Filename
+			if err := buff.Flush(); err != nil {
+				return err
+			}
+			bm.stats.DirtyFlushes++
+			written[filename] = true
+		}
+	}
+	for filename := range written {
+		if err := bm.fm.Sync(filename); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-// Unpins the specified data buffer
+// Unpins the specified data buffer.
+// Pin calls waiting for a buffer are woken up if it becomes unpinned.
 func (bm *BufferMgr) Unpin(buff *Buffer) {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
+	bm.unpin(buff)
+}
+
+// unpin unpins buff. The buffer manager must be locked.
+func (bm *BufferMgr) unpin(buff *Buffer) {
+	if !buff.IsPinned() {
+		return
+	}
 	buff.Unpin()
+	if !buff.IsPinned() {
+		bm.numAvailable++
+		close(bm.unpinned)
+		bm.unpinned = make(chan struct{})
+	}
+}
+
+// Pin pins a buffer to the specified block, waiting for a buffer to become available
+// if they are all pinned, up to the timeout of the buffer manager.
+// Returns an error wrapping ErrBufferAbort if none became available in time,
+// and an error if the block could not be read into the buffer.
+func (bm *BufferMgr) Pin(blk *file.BlockId) (*Buffer, error) {
+	return bm.PinWithTimeout(blk, bm.timeout)
+}
+
+// PinWithTimeout is like Pin, but waits up to timeout for a buffer to become available.
+func (bm *BufferMgr) PinWithTimeout(blk *file.BlockId, timeout time.Duration) (*Buffer, error) {
+	return bm.PinInRing(blk, nil, timeout)
 }
 
-func (bm *BufferMgr) Pin(blk *file.BlockId) *Buffer {
-	// fmt.Printf("start Pin %+v\n", blk)
-	deadline := time.Now().Add(MAX_TIME)
-	// fmt.Printf("TryLockWithTimeout ok? %+v\n", ok)
+// PinInRing is like PinWithTimeout, but reads blk into a buffer of ring if it isn't in the pool.
+// A nil ring stands for the whole pool.
+func (bm *BufferMgr) PinInRing(blk *file.BlockId, ring *Ring, timeout time.Duration) (*Buffer, error) {
+	var timer *time.Timer
+	var waitStart time.Time
 	for {
-		// fmt.Printf("Trying to get pin for %v ", blk)
-		if time.Now().After(deadline) {
-			return nil
-		}
-		gotLock := bm.mu.TryLockWithTimeout(time.Until(deadline))
-		// fmt.Printf("Pin get lock for %v, ok? %+v\n", blk, ok)
-		if gotLock {
-			b := bm.tryPin(blk)
+		bm.mu.Lock()
+		if b := bm.buffers[*blk]; b != nil && b.loading != nil {
+			// the block is being read ahead
+			loading := b.loading
 			bm.mu.Unlock()
-			if b != nil {
-				return b
-			}
-		} else {
-			// fmt.Printf("Block %v timed out", blk)
-			return nil
+			<-loading
+			continue
+		}
+		b, err := bm.tryPin(blk, ring)
+		if timer != nil && (b != nil || err != nil) {
+			bm.stats.PinWaitTime += time.Since(waitStart)
+		}
+		unpinned := bm.unpinned
+		bm.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			return b, nil
 		}
 
+		if timer == nil {
+			waitStart = time.Now()
+			timer = time.NewTimer(timeout)
+			defer timer.Stop()
+			bm.mu.Lock()
+			bm.stats.PinWaits++
+			bm.waiters++
+			bm.mu.Unlock()
+			defer func() {
+				bm.mu.Lock()
+				bm.waiters--
+				bm.mu.Unlock()
+			}()
+		}
+		select {
+		case <-unpinned:
+		case <-timer.C:
+			bm.mu.Lock()
+			bm.stats.PinWaitTime += time.Since(waitStart)
+			bm.mu.Unlock()
+			return nil, fmt.Errorf("pinning block %v: waited %v: %w", blk, timeout, ErrBufferAbort)
+		}
 	}
 }
 
 // tryPin tries to pin a buffer to the specified block.
 // If there is already a buffer assigned to that block
 // then that buffer is used;
-// otherwise, an unpinned buffer from the pool is chosen.
+// otherwise, an unpinned buffer of the ring, if any, or of the pool is chosen.
 // Returns a null value if there are no available buffers.
-func (bm *BufferMgr) tryPin(blk *file.BlockId) *Buffer {
+func (bm *BufferMgr) tryPin(blk *file.BlockId, ring *Ring) (*Buffer, error) {
 	b := bm.findExistingBuffer(blk)
-	if b == nil {
-		b = bm.chooseUnpinnedBuffer()
+	loaded := b == nil
+	if loaded {
+		if ring != nil {
+			b = bm.ringBuffer(ring)
+		}
+		if b == nil {
+			b = bm.chooseUnpinnedBuffer()
+		}
 		if b == nil {
-			return nil
+			return nil, nil
 		}
-		b.AssignToBlock(blk)
+		evicted := b.Block()
+		dirty := b.ModifyingTx() >= 0
+		err := b.AssignToBlock(blk)
+		if dirty && b.ModifyingTx() < 0 {
+			bm.stats.DirtyFlushes++
+		}
+		// the buffer keeps its block if it couldn't be written
+		if evicted != nil && b.Block() != evicted {
+			delete(bm.buffers, *evicted)
+			bm.stats.Evictions++
+		}
+		if err != nil {
+			return nil, fmt.Errorf("assigning buffer to block %v: %w", blk, err)
+		}
+		bm.buffers[*blk] = b
+		b.ring = ring
+		bm.stats.Misses++
+	} else {
+		if b.ring != ring {
+			b.ring = nil
+		}
+		bm.stats.Hits++
 	}
+	bm.stats.Pins++
+	bm.policy.Pinned(b.index, *blk, loaded)
 
 	if !b.IsPinned() {
 		bm.numAvailable--
 	}
 	b.Pin()
-	return b
+	delete(bm.prefetched, b)
+	bm.readAheadAfter(*blk, ring)
+	return b, nil
 }
 
+// findExistingBuffer returns the buffer assigned to blk, or nil if blk isn't in the pool.
 func (bm *BufferMgr) findExistingBuffer(blk *file.BlockId) *Buffer {
-	for _, b := range bm.bufferpool {
-		if b.blk != nil && *b.blk == *blk {
+	return bm.buffers[*blk]
+}
+
+// freshBuffer returns an unpinned buffer that was never assigned a block, or nil.
+func (bm *BufferMgr) freshBuffer() *Buffer {
+	for ; bm.fresh < len(bm.bufferpool); bm.fresh++ {
+		if b := bm.bufferpool[bm.fresh]; b.Block() == nil && !b.IsPinned() {
 			return b
 		}
 	}
 	return nil
 }
 
+// chooseUnpinnedBuffer returns the unpinned buffer picked by the replacement policy,
+// or nil if every buffer is pinned.
+// The blocks read ahead that weren't pinned yet are only replaced if every other buffer
+// is pinned: they are held by a pin of their own while the policy picks its victim.
 func (bm *BufferMgr) chooseUnpinnedBuffer() *Buffer {
-	// naive buffer search, return first unpinned.
-	// Alternatives: LRU, FIFO ...
-	for _, b := range bm.bufferpool {
-		if !b.IsPinned() {
-			return b
-		}
+	for b := range bm.prefetched {
+		b.Pin()
 	}
-	return nil
+	i := bm.policy.Victim(bm.bufferpool)
+	for b := range bm.prefetched {
+		b.Unpin()
+	}
+	if i < 0 && len(bm.prefetched) > 0 {
+		i = bm.policy.Victim(bm.bufferpool)
+	}
+	if i < 0 {
+		return nil
+	}
+	return bm.bufferpool[i]
 }
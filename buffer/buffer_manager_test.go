@@ -1,6 +1,8 @@
 package buffer
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -31,27 +33,36 @@ func TestBufferMgr(t *testing.T) {
 		fm.Append(testFileName)
 	}
 
-	bm := NewBufferMgr(fm, logMgr, 3)
+	const timeout = 300 * time.Millisecond
+	bm := NewBufferMgr(fm, logMgr, 3, WithPinTimeout(timeout))
 	var buff [20]*Buffer
+	var errs [20]error
 
 	// Pin blocks
-	buff[0] = bm.Pin(file.NewBlockId(testFileName, 0))
-	buff[1] = bm.Pin(file.NewBlockId(testFileName, 1))
-	buff[2] = bm.Pin(file.NewBlockId(testFileName, 2))
+	buff[0], _ = bm.Pin(file.NewBlockId(testFileName, 0))
+	buff[1], _ = bm.Pin(file.NewBlockId(testFileName, 1))
+	buff[2], _ = bm.Pin(file.NewBlockId(testFileName, 2))
 
 	// Unpin block 1
 	bm.Unpin(buff[1])
 	buff[1] = nil
 
 	// Pin blocks 0 and 1 again
-	buff[3] = bm.Pin(file.NewBlockId(testFileName, 0)) // block 0 pinned twice
-	buff[4] = bm.Pin(file.NewBlockId(testFileName, 1)) // block 1 repinned
+	buff[3], _ = bm.Pin(file.NewBlockId(testFileName, 0)) // block 0 pinned twice
+	buff[4], _ = bm.Pin(file.NewBlockId(testFileName, 1)) // block 1 repinned
 
 	// Try to pin block 3 when no buffers are available
-	buff[5] = bm.Pin(file.NewBlockId(testFileName, 3))
+	start := time.Now()
+	buff[5], errs[5] = bm.Pin(file.NewBlockId(testFileName, 3))
 	if buff[5] != nil {
 		t.Errorf("Expected no available buffer for block 3, but it was pinned")
 	}
+	if !errors.Is(errs[5], ErrBufferAbort) {
+		t.Errorf("Expected ErrBufferAbort, got %v", errs[5])
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Errorf("Pin gave up after %v, expected to wait %v", waited, timeout)
+	}
 	//  remove second pin of block 0
 	bm.Unpin(buff[3])
 
@@ -60,29 +71,29 @@ func TestBufferMgr(t *testing.T) {
 	wg.Add(5)
 	go func() {
 		defer wg.Done()
-		buff[6] = bm.Pin(file.NewBlockId(testFileName, 4))
+		buff[6], errs[6] = bm.Pin(file.NewBlockId(testFileName, 4))
 	}()
 	go func() {
 		defer wg.Done()
-		buff[7] = bm.Pin(file.NewBlockId(testFileName, 5))
+		buff[7], errs[7] = bm.Pin(file.NewBlockId(testFileName, 5))
 	}()
 
 	go func() {
 		defer wg.Done()
-		buff[8] = bm.Pin(file.NewBlockId(testFileName, 6))
+		buff[8], errs[8] = bm.Pin(file.NewBlockId(testFileName, 6))
 	}()
 
 	go func() {
 		defer wg.Done()
-		buff[9] = bm.Pin(file.NewBlockId(testFileName, 7))
+		buff[9], errs[9] = bm.Pin(file.NewBlockId(testFileName, 7))
 	}()
 
 	go func() {
 		defer wg.Done()
-		bm.Unpin(buff[0]) // one of the three pins above should succeed
-		time.Sleep(MAX_TIME / 2)
+		bm.Unpin(buff[0]) // one of the four pins above should succeed
+		time.Sleep(timeout / 3)
 		bm.Unpin(buff[2]) // then another one
-		time.Sleep(MAX_TIME / 2)
+		time.Sleep(timeout)
 		bm.Unpin(buff[4]) // too late, last pin requests should time out
 
 	}()
@@ -93,6 +104,9 @@ func TestBufferMgr(t *testing.T) {
 	for i := 6; i < 10; i++ {
 		if buff[i] == nil {
 			actualNils++
+			if !errors.Is(errs[i], ErrBufferAbort) {
+				t.Errorf("Expected ErrBufferAbort, got %v", errs[i])
+			}
 		}
 	}
 	// fmt.Printf("%+v", buff)
@@ -102,3 +116,96 @@ func TestBufferMgr(t *testing.T) {
 	}
 
 }
+
+func TestBufferMgrCorruptBlock(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "bufferCorrupt")
+	os.RemoveAll(tempDir) // clean up any previous runs
+
+	testFileName := "testfile"
+	fm, err := file.NewFileMgr(tempDir, 128, file.WithChecksums())
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	logMgr, err := log.NewLogMgr(fm, "testlogfile")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	if _, err := fm.Append(testFileName); err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+
+	// zero out the block, checksum included
+	if err := os.WriteFile(filepath.Join(tempDir, testFileName), make([]byte, 132), 0666); err != nil {
+		t.Fatalf("Failed to corrupt block: %v", err)
+	}
+
+	bm := NewBufferMgr(fm, logMgr, 3)
+	blk := file.NewBlockId(testFileName, 0)
+	buff, err := bm.Pin(blk)
+	var corrupt *file.CorruptBlockError
+	if buff != nil || !errors.As(err, &corrupt) {
+		t.Fatalf("Pin(%v) = %v, %v; expected a CorruptBlockError", blk, buff, err)
+	}
+	if bm.findExistingBuffer(blk) != nil {
+		t.Errorf("corrupt block %v should not stay assigned to a buffer", blk)
+	}
+}
+
+// newTestMgrs returns the managers of an in-memory database with 128-byte blocks,
+// whose file "testfile" holds blocks empty blocks. The log manager is created with opts.
+func newTestMgrs(tb testing.TB, blocks int, opts ...log.Option) (*file.FileMgr, *log.LogMgr) {
+	tb.Helper()
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	if err != nil {
+		tb.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	lm, err := log.NewLogMgr(fm, "testlogfile", opts...)
+	if err != nil {
+		tb.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	for i := 0; i < blocks; i++ {
+		if _, err := fm.Append("testfile"); err != nil {
+			tb.Fatalf("Failed to append block: %v", err)
+		}
+	}
+	return fm, lm
+}
+
+func TestBufferMgrBlockLookup(t *testing.T) {
+	fm, logMgr := newTestMgrs(t, 3)
+	bm := NewBufferMgr(fm, logMgr, 2, WithReplacement(LRU))
+
+	blks := []*file.BlockId{file.NewBlockId("testfile", 0), file.NewBlockId("testfile", 1), file.NewBlockId("testfile", 2)}
+	for _, blk := range blks {
+		buff, err := bm.Pin(blk)
+		if buff == nil || err != nil {
+			t.Fatalf("Pin(%v) = %v, %v", blk, buff, err)
+		}
+		bm.Unpin(buff)
+	}
+	// block 0 was replaced by block 2
+	if b := bm.findExistingBuffer(blks[0]); b != nil {
+		t.Errorf("replaced block %v is still mapped to %v", blks[0], b.Block())
+	}
+	for _, blk := range blks[1:] {
+		if b := bm.findExistingBuffer(file.NewBlockId(blk.Filename, blk.Blknum)); b == nil || *b.Block() != *blk {
+			t.Errorf("block %v is not mapped to its buffer", blk)
+		}
+	}
+}
+
+// BenchmarkPinHit pins a block that is in the pool, whose size shouldn't matter.
+func BenchmarkPinHit(b *testing.B) {
+	for _, numbuffs := range []int{8, 80000} {
+		b.Run(fmt.Sprintf("buffers=%d", numbuffs), func(b *testing.B) {
+			fm, logMgr := newTestMgrs(b, 1)
+			bm := NewBufferMgr(fm, logMgr, numbuffs)
+			blk := file.NewBlockId("testfile", 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buff, _ := bm.Pin(blk)
+				bm.Unpin(buff)
+			}
+		})
+	}
+}
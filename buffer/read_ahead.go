@@ -0,0 +1,155 @@
+package buffer
+
+import "github.com/CefBoud/CefDB/file"
+
+// WithReadAhead makes the buffer manager read the next k blocks of a file ahead of time,
+// in the background, once the file is pinned sequentially, as a table scan does.
+// Blocks are read ahead into the buffers that were never used, then into the clean,
+// unpinned buffers chosen by the replacement policy, but never into the last quarter
+// of the available buffers nor while a pin is waiting for a buffer,
+// so that read-ahead doesn't starve transactions of pins.
+// Read-ahead stops rather than replace a block read ahead that wasn't pinned yet.
+func WithReadAhead(k int) Option {
+	return func(bm *BufferMgr) {
+		bm.readAhead = &readAhead{
+			k:       k,
+			reserve: max(len(bm.bufferpool)/4, 1),
+			last:    make(map[string]int),
+			upTo:    make(map[string]int),
+		}
+	}
+}
+
+// readAhead detects the files that are pinned sequentially.
+type readAhead struct {
+	k       int
+	reserve int            // available buffers read-ahead leaves to pins
+	last    map[string]int // last block pinned in each file
+	upTo    map[string]int // last block read ahead in each file being pinned sequentially
+}
+
+// pinned records that blk was pinned and returns the range of blocks to read ahead,
+// empty unless blk follows the last block pinned in its file.
+func (ra *readAhead) pinned(blk file.BlockId) (from, to int) {
+	last, seen := ra.last[blk.Filename]
+	if seen && blk.Blknum == last {
+		return 0, -1
+	}
+	ra.last[blk.Filename] = blk.Blknum
+	if !seen || blk.Blknum != last+1 {
+		delete(ra.upTo, blk.Filename)
+		return 0, -1
+	}
+	from = blk.Blknum + 1
+	if upTo, ok := ra.upTo[blk.Filename]; ok {
+		from = max(from, upTo+1)
+	}
+	to = blk.Blknum + ra.k
+	if from <= to {
+		ra.upTo[blk.Filename] = to
+	}
+	return from, to
+}
+
+// stopped records that reading ahead filename stopped before blknum,
+// so that the next sequential pin reads ahead from blknum again.
+func (ra *readAhead) stopped(filename string, blknum int) {
+	if upTo, ok := ra.upTo[filename]; ok {
+		ra.upTo[filename] = min(upTo, blknum-1)
+	}
+}
+
+// readAheadAfter starts reading ahead the blocks following blk, if it is pinned sequentially.
+// Blocks pinned in a ring are read ahead into the ring.
+// The buffer manager must be locked.
+func (bm *BufferMgr) readAheadAfter(blk file.BlockId, ring *Ring) {
+	if bm.readAhead == nil {
+		return
+	}
+	from, to := bm.readAhead.pinned(blk)
+	if from > to {
+		return
+	}
+	bm.prefetching.Add(1)
+	go bm.prefetchRange(blk.Filename, from, to, ring)
+}
+
+// WaitReadAhead waits for the blocks being read ahead to be in the pool.
+func (bm *BufferMgr) WaitReadAhead() {
+	bm.prefetching.Wait()
+}
+
+// prefetchRange reads blocks from to to of filename into the pool, stopping at the end
+// of the file or when no buffer can be spared.
+func (bm *BufferMgr) prefetchRange(filename string, from, to int, ring *Ring) {
+	defer bm.prefetching.Done()
+	size, err := bm.fm.Length(filename)
+	if err != nil {
+		return
+	}
+	blknum := from
+	for ; blknum <= to && blknum < size; blknum++ {
+		if !bm.prefetch(file.NewBlockId(filename, blknum), ring) {
+			break
+		}
+	}
+	if blknum <= to {
+		bm.mu.Lock()
+		bm.readAhead.stopped(filename, blknum)
+		bm.mu.Unlock()
+	}
+}
+
+// prefetch reads blk into a clean, unpinned buffer, unless it is already in the pool.
+// The buffer is pinned, without the buffer manager being locked, while the block is read:
+// pins of blk wait for the read to complete.
+// Returns false if no buffer could be spared or the block couldn't be read.
+func (bm *BufferMgr) prefetch(blk *file.BlockId, ring *Ring) bool {
+	bm.mu.Lock()
+	if bm.buffers[*blk] != nil {
+		bm.mu.Unlock()
+		return true
+	}
+	if bm.waiters > 0 || bm.numAvailable <= bm.readAhead.reserve {
+		bm.mu.Unlock()
+		return false
+	}
+	var b *Buffer
+	if ring != nil {
+		b = bm.ringBuffer(ring)
+	} else if b = bm.freshBuffer(); b == nil {
+		b = bm.chooseUnpinnedBuffer()
+	}
+	// writing dirty pages is left to evictions and to the background writer
+	if b == nil || bm.prefetched[b] || b.ModifyingTx() >= 0 {
+		bm.mu.Unlock()
+		return false
+	}
+	if evicted := b.Block(); evicted != nil {
+		delete(bm.buffers, *evicted)
+		bm.stats.Evictions++
+	}
+	bm.buffers[*blk] = b
+	loading := make(chan struct{})
+	b.loading = loading
+	b.ring = ring
+	b.Pin()
+	bm.numAvailable--
+	bm.policy.Pinned(b.index, *blk, true)
+	bm.mu.Unlock()
+
+	err := b.read(blk)
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if err != nil {
+		delete(bm.buffers, *blk)
+	} else {
+		bm.prefetched[b] = true
+		bm.stats.Prefetches++
+	}
+	b.loading = nil
+	close(loading)
+	bm.unpin(b)
+	return err == nil
+}
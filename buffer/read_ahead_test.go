@@ -0,0 +1,140 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+func newReadAheadPool(t *testing.T, blocks, numbuffs, k int, opts ...Option) *BufferMgr {
+	t.Helper()
+	fm, lm := newTestMgrs(t, blocks)
+	p := file.NewPage(fm.BlockSize())
+	for i := 0; i < blocks; i++ {
+		blk := file.NewBlockId("testfile", i)
+		p.SetInt(0, 100+i)
+		if err := fm.Write(blk, p); err != nil {
+			t.Fatalf("Write(%v): %v", blk, err)
+		}
+	}
+	opts = append(opts, WithReadAhead(k), WithPinTimeout(100*time.Millisecond))
+	return NewBufferMgr(fm, lm, numbuffs, opts...)
+}
+
+func TestReadAhead(t *testing.T) {
+	bm := newReadAheadPool(t, 6, 8, 3)
+
+	// a scan of the file: the blocks following the second one are read ahead,
+	// up to the end of the file
+	for i := 0; i < 6; i++ {
+		buff, err := bm.Pin(file.NewBlockId("testfile", i))
+		if err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+		if got, _ := buff.Contents().GetInt(0); got != 100+i {
+			t.Errorf("block %d holds %d, want %d", i, got, 100+i)
+		}
+		bm.Unpin(buff)
+		bm.WaitReadAhead()
+	}
+	stats := bm.Stats()
+	if stats.Prefetches != 4 || stats.Misses != 2 || stats.Hits != 4 {
+		t.Errorf("scan: %d prefetches, %d misses and %d hits, want 4, 2 and 4",
+			stats.Prefetches, stats.Misses, stats.Hits)
+	}
+	if len(bm.prefetched) != 0 {
+		t.Errorf("%d blocks read ahead left unpinned after the scan, want 0", len(bm.prefetched))
+	}
+
+	// random access doesn't read ahead
+	bm.ResetStats()
+	for _, i := range []int{5, 0, 3} {
+		buff, err := bm.Pin(file.NewBlockId("testfile", i))
+		if err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+		bm.Unpin(buff)
+		bm.WaitReadAhead()
+	}
+	if stats := bm.Stats(); stats.Prefetches != 0 {
+		t.Errorf("random access: %d prefetches, want 0", stats.Prefetches)
+	}
+}
+
+func TestReadAheadDoesNotStarvePins(t *testing.T) {
+	bm := newReadAheadPool(t, 8, 4, 4)
+
+	// the scan keeps its blocks pinned: the two other buffers are read into,
+	// and read-ahead stops there rather than replace the blocks it read
+	for i := 0; i < 2; i++ {
+		if _, err := bm.Pin(file.NewBlockId("testfile", i)); err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+	}
+	bm.WaitReadAhead()
+	if stats := bm.Stats(); stats.Prefetches != 2 || stats.Available != 2 {
+		t.Errorf("got %d prefetches and %d available buffers, want 2 and 2", stats.Prefetches, stats.Available)
+	}
+	// the blocks read ahead are replaced by other pins
+	for _, i := range []int{6, 7} {
+		if _, err := bm.Pin(file.NewBlockId("testfile", i)); err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+	}
+	bm.WaitReadAhead()
+	if stats := bm.Stats(); stats.Available != 0 {
+		t.Errorf("%d available buffers, want 0", stats.Available)
+	}
+
+	// dirty buffers aren't read into
+	bm = newReadAheadPool(t, 8, 4, 4, WithReplacement(LRU))
+	for _, i := range []int{7, 5, 3} {
+		buff, err := bm.Pin(file.NewBlockId("testfile", i))
+		if err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+		buff.SetModified(1, -1)
+		bm.Unpin(buff)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bm.Pin(file.NewBlockId("testfile", i)); err != nil {
+			t.Fatalf("Pin(%d): %v", i, err)
+		}
+	}
+	bm.WaitReadAhead()
+	if stats := bm.Stats(); stats.Prefetches != 0 {
+		t.Errorf("%d prefetches into a dirty buffer, want 0", stats.Prefetches)
+	}
+}
+
+func TestReadAheadLongScan(t *testing.T) {
+	policies := []struct {
+		name string
+		r    Replacement
+	}{
+		{"FirstUnpinned", FirstUnpinned},
+		{"LRU", LRU},
+		{"Clock", Clock},
+		{"LRU-2", LRUK(2)},
+	}
+	for _, p := range policies {
+		// a scan of a file several times the size of the pool
+		bm := newReadAheadPool(t, 60, 8, 8, WithReplacement(p.r))
+		for i := 0; i < 60; i++ {
+			buff, err := bm.Pin(file.NewBlockId("testfile", i))
+			if err != nil {
+				t.Fatalf("%v: Pin(%d): %v", p.name, i, err)
+			}
+			if got, _ := buff.Contents().GetInt(0); got != 100+i {
+				t.Errorf("%v: block %d holds %d, want %d", p.name, i, got, 100+i)
+			}
+			bm.Unpin(buff)
+			bm.WaitReadAhead()
+		}
+		// only the first two blocks, pinned before the scan is detected, are missed
+		if stats := bm.Stats(); stats.Misses != 2 {
+			t.Errorf("%v: %d misses and %d hits, want 2 misses", p.name, stats.Misses, stats.Hits)
+		}
+	}
+}
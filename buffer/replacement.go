@@ -0,0 +1,190 @@
+package buffer
+
+import "github.com/CefBoud/CefDB/file"
+
+// ReplacementPolicy chooses the buffer that is assigned to a block that isn't in the pool.
+// Buffers are identified by their index in the pool.
+// The methods are called with the buffer manager locked.
+type ReplacementPolicy interface {
+	// Pinned records that buffer i was pinned to blk. loaded is true if the buffer
+	// was just assigned to blk.
+	Pinned(i int, blk file.BlockId, loaded bool)
+	// Victim returns the index of the unpinned buffer of pool to assign to a new block,
+	// or -1 if every buffer is pinned.
+	Victim(pool []*Buffer) int
+}
+
+// Replacement creates a ReplacementPolicy for a pool of numbuffs buffers.
+type Replacement func(numbuffs int) ReplacementPolicy
+
+// Option configures optional BufferMgr behaviour.
+type Option func(*BufferMgr)
+
+// WithReplacement sets the replacement policy of the buffer pool.
+// By default, the first unpinned buffer is replaced.
+func WithReplacement(r Replacement) Option {
+	return func(bm *BufferMgr) {
+		bm.policy = r(len(bm.bufferpool))
+	}
+}
+
+// FirstUnpinned replaces the first unpinned buffer of the pool, whatever its use.
+var FirstUnpinned Replacement = func(int) ReplacementPolicy {
+	return firstUnpinned{}
+}
+
+type firstUnpinned struct{}
+
+func (firstUnpinned) Pinned(int, file.BlockId, bool) {}
+
+func (firstUnpinned) Victim(pool []*Buffer) int {
+	for i, b := range pool {
+		if !b.IsPinned() {
+			return i
+		}
+	}
+	return -1
+}
+
+// LRU replaces the unpinned buffer that was least recently pinned.
+var LRU Replacement = func(numbuffs int) ReplacementPolicy {
+	return &lru{lastUsed: make([]uint64, numbuffs)}
+}
+
+type lru struct {
+	lastUsed []uint64
+	tick     uint64
+}
+
+func (p *lru) Pinned(i int, blk file.BlockId, loaded bool) {
+	p.tick++
+	p.lastUsed[i] = p.tick
+}
+
+func (p *lru) Victim(pool []*Buffer) int {
+	victim := -1
+	for i, b := range pool {
+		if !b.IsPinned() && (victim < 0 || p.lastUsed[i] < p.lastUsed[victim]) {
+			victim = i
+		}
+	}
+	return victim
+}
+
+// Clock approximates LRU with a reference bit per buffer: a hand sweeps the pool,
+// giving a second chance to the buffers pinned since it last passed them.
+var Clock Replacement = func(numbuffs int) ReplacementPolicy {
+	return &clock{referenced: make([]bool, numbuffs)}
+}
+
+type clock struct {
+	referenced []bool
+	hand       int
+}
+
+func (p *clock) Pinned(i int, blk file.BlockId, loaded bool) {
+	p.referenced[i] = true
+}
+
+func (p *clock) Victim(pool []*Buffer) int {
+	// the second sweep finds a victim if there is an unpinned buffer
+	for range 2 * len(pool) {
+		i := p.hand
+		p.hand = (p.hand + 1) % len(pool)
+		if pool[i].IsPinned() {
+			continue
+		}
+		if p.referenced[i] {
+			p.referenced[i] = false
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// LRUK replaces the unpinned buffer whose k-th most recent pin is the oldest.
+// Buffers whose block was pinned fewer than k times go first, least recently pinned first,
+// so that pages read once by a scan don't evict frequently used pages.
+// The pin history of a block is kept for a while after its buffer is replaced,
+// so that a block used regularly, but less often than the pool is cycled, is recognized.
+func LRUK(k int) Replacement {
+	return func(numbuffs int) ReplacementPolicy {
+		return &lruK{
+			k:         k,
+			retention: uint64(8 * numbuffs),
+			resident:  make([]file.BlockId, numbuffs),
+			residents: make(map[file.BlockId]int),
+			history:   make(map[file.BlockId][]uint64),
+		}
+	}
+}
+
+type lruK struct {
+	k         int
+	retention uint64                    // pins after which the history of a replaced block is dropped
+	resident  []file.BlockId            // block of each buffer
+	residents map[file.BlockId]int      // number of buffers holding each block
+	history   map[file.BlockId][]uint64 // times of the last k pins of each block, most recent first
+	tick      uint64
+}
+
+func (p *lruK) Pinned(i int, blk file.BlockId, loaded bool) {
+	p.tick++
+	if old := p.resident[i]; old != blk {
+		if p.residents[old]--; p.residents[old] <= 0 {
+			delete(p.residents, old)
+		}
+		p.residents[blk]++
+		p.resident[i] = blk
+	}
+	h := p.history[blk]
+	if len(h) < p.k {
+		h = append(h, 0)
+	}
+	copy(h[1:], h)
+	h[0] = p.tick
+	p.history[blk] = h
+	if len(p.history) > 2*int(p.retention) {
+		p.forget()
+	}
+}
+
+// forget drops the history of the replaced blocks that weren't pinned during the retention period.
+func (p *lruK) forget() {
+	for blk, h := range p.history {
+		if h[0]+p.retention < p.tick && p.residents[blk] == 0 {
+			delete(p.history, blk)
+		}
+	}
+}
+
+func (p *lruK) Victim(pool []*Buffer) int {
+	victim := -1
+	for i, b := range pool {
+		if !b.IsPinned() && (victim < 0 || p.before(i, victim)) {
+			victim = i
+		}
+	}
+	return victim
+}
+
+// before returns true if buffer i should be replaced before buffer j.
+func (p *lruK) before(i, j int) bool {
+	hi, hj := p.history[p.resident[i]], p.history[p.resident[j]]
+	if len(hi) < p.k || len(hj) < p.k {
+		if len(hi) >= p.k || len(hj) >= p.k {
+			return len(hi) < p.k
+		}
+		return last(hi) < last(hj)
+	}
+	return hi[p.k-1] < hj[p.k-1]
+}
+
+// last returns the time of the most recent pin in h, or 0 for a buffer never pinned.
+func last(h []uint64) uint64 {
+	if len(h) == 0 {
+		return 0
+	}
+	return h[0]
+}
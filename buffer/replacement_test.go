@@ -0,0 +1,183 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// countingPolicy counts the pins of a pool and how many of them had to load a block.
+type countingPolicy struct {
+	ReplacementPolicy
+	pins  int
+	loads int
+}
+
+func (p *countingPolicy) Pinned(i int, blk file.BlockId, loaded bool) {
+	p.pins++
+	if loaded {
+		p.loads++
+	}
+	p.ReplacementPolicy.Pinned(i, blk, loaded)
+}
+
+func (p *countingPolicy) hitRatio() float64 {
+	return float64(p.pins-p.loads) / float64(p.pins)
+}
+
+const (
+	catalogBlocks = 6
+	dataBlocks    = 200
+	poolSize      = 8
+)
+
+// newScanPool returns a pool of poolSize buffers over an in-memory database
+// holding a small catalog file and a large data file.
+func newScanPool(tb testing.TB, r Replacement) (*BufferMgr, *countingPolicy) {
+	fm, lm := newTestMgrs(tb, 0)
+	for i := 0; i < catalogBlocks; i++ {
+		fm.Append("catalog")
+	}
+	for i := 0; i < dataBlocks; i++ {
+		fm.Append("data")
+	}
+	var counting *countingPolicy
+	bm := NewBufferMgr(fm, lm, poolSize, WithReplacement(func(numbuffs int) ReplacementPolicy {
+		counting = &countingPolicy{ReplacementPolicy: r(numbuffs)}
+		return counting
+	}))
+	return bm, counting
+}
+
+// scanWithLookups scans the data file, looking up a catalog block every few data blocks,
+// as a query does when it scans a table and reads the metadata of the fields it evaluates.
+func scanWithLookups(tb testing.TB, bm *BufferMgr) {
+	pin := func(blk *file.BlockId) {
+		buff, err := bm.Pin(blk)
+		if buff == nil || err != nil {
+			tb.Fatalf("Pin(%v) = %v, %v", blk, buff, err)
+		}
+		bm.Unpin(buff)
+	}
+	for i := 0; i < dataBlocks; i++ {
+		pin(file.NewBlockId("data", i))
+		if i%4 == 0 {
+			pin(file.NewBlockId("catalog", (i/4)%catalogBlocks))
+		}
+	}
+}
+
+var policies = []struct {
+	name string
+	r    Replacement
+}{
+	{"FirstUnpinned", FirstUnpinned},
+	{"LRU", LRU},
+	{"Clock", Clock},
+	{"LRU-2", LRUK(2)},
+}
+
+func TestReplacementPolicies(t *testing.T) {
+	ratios := make(map[string]float64)
+	for _, p := range policies {
+		bm, counting := newScanPool(t, p.r)
+		for range 3 {
+			scanWithLookups(t, bm)
+		}
+		ratios[p.name] = counting.hitRatio()
+	}
+	// the catalog blocks stay in the pool with LRU-2 only
+	if ratios["LRU-2"] <= ratios["LRU"] || ratios["LRU-2"] <= ratios["Clock"] || ratios["LRU-2"] <= ratios["FirstUnpinned"] {
+		t.Errorf("expected LRU-2 to have the best hit ratio, got %v", ratios)
+	}
+
+	// every policy replaces unpinned buffers only, and reports a full pool
+	for _, p := range policies {
+		bm, _ := newScanPool(t, p.r)
+		var pinned []*Buffer
+		for i := 0; i < poolSize; i++ {
+			buff, _ := bm.Pin(file.NewBlockId("data", i))
+			pinned = append(pinned, buff)
+		}
+		bm.Unpin(pinned[3])
+		buff, _ := bm.Pin(file.NewBlockId("data", poolSize))
+		if buff != pinned[3] {
+			t.Errorf("%v: expected the only unpinned buffer to be replaced", p.name)
+		}
+		if i := bm.policy.Victim(bm.bufferpool); i != -1 {
+			t.Errorf("%v: Victim() = %v with every buffer pinned, expected -1", p.name, i)
+		}
+	}
+}
+
+func TestLRUVictims(t *testing.T) {
+	pool := make([]*Buffer, 3)
+	for i := range pool {
+		pool[i] = &Buffer{index: i}
+	}
+	lru := LRU(len(pool))
+	clock := Clock(len(pool))
+	for _, i := range []int{0, 1, 2, 0} {
+		lru.Pinned(i, *file.NewBlockId("data", i), false)
+		clock.Pinned(i, *file.NewBlockId("data", i), false)
+	}
+	if v := lru.Victim(pool); v != 1 {
+		t.Errorf("LRU victim = %v, expected 1", v)
+	}
+	// every buffer was referenced: the hand clears them all and comes back to the first one
+	if v := clock.Victim(pool); v != 0 {
+		t.Errorf("Clock victim = %v, expected 0", v)
+	}
+	clock.Pinned(1, *file.NewBlockId("data", 1), false)
+	if v := clock.Victim(pool); v != 2 {
+		t.Errorf("Clock victim = %v, expected 2", v)
+	}
+
+	lruK := LRUK(2)(len(pool))
+	for _, i := range []int{0, 0, 1, 1, 2} {
+		lruK.Pinned(i, *file.NewBlockId("data", i), false)
+	}
+	if v := lruK.Victim(pool); v != 2 {
+		t.Errorf("LRU-2 victim = %v, expected the buffer pinned once", v)
+	}
+	lruK.Pinned(2, *file.NewBlockId("data", 2), false)
+	if v := lruK.Victim(pool); v != 0 {
+		t.Errorf("LRU-2 victim = %v, expected 0", v)
+	}
+}
+
+func TestLRUKForget(t *testing.T) {
+	p := LRUK(2)(2).(*lruK)
+	hot := *file.NewBlockId("catalog", 0)
+	p.Pinned(0, hot, true)
+	p.Pinned(0, hot, false)
+	// a scan cycles through the other buffer, long after the last pin of hot
+	for i := 0; i < 100; i++ {
+		p.Pinned(1, *file.NewBlockId("data", i), true)
+	}
+	if len(p.history) > 2*int(p.retention)+1 {
+		t.Errorf("history of %d blocks, expected at most %d", len(p.history), 2*p.retention+1)
+	}
+	if len(p.history[hot]) != 2 {
+		t.Errorf("history of the resident block %v was dropped", hot)
+	}
+	if _, ok := p.history[*file.NewBlockId("data", 0)]; ok {
+		t.Errorf("history of a replaced block was kept past the retention period")
+	}
+	if len(p.residents) != 2 {
+		t.Errorf("%d resident blocks, expected 2", len(p.residents))
+	}
+}
+
+// BenchmarkReplacementPolicies reports the hit ratio of each policy on a scan with catalog lookups.
+func BenchmarkReplacementPolicies(b *testing.B) {
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			bm, counting := newScanPool(b, p.r)
+			for i := 0; i < b.N; i++ {
+				scanWithLookups(b, bm)
+			}
+			b.ReportMetric(counting.hitRatio(), "hits/pin")
+		})
+	}
+}
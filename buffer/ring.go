@@ -0,0 +1,51 @@
+package buffer
+
+import "slices"
+
+// RING_SIZE is the number of buffers of the ring of a large scan or bulk load.
+const RING_SIZE = 16
+
+// Ring is a small set of buffers that a large scan, or bulk load, reuses for the blocks
+// it reads into the pool, so that it doesn't evict the pages other transactions work with.
+// Blocks already in the pool are pinned as usual, and a buffer of the ring that another
+// pin uses leaves the ring.
+// A ring is used by one transaction at a time, and is guarded by the buffer manager.
+type Ring struct {
+	buffers []*Buffer
+	size    int
+	next    int // position of the next buffer to reuse
+}
+
+// NewRing creates a ring of up to size buffers, and at most a quarter of the pool.
+// The ring takes its buffers from the pool as it is used.
+func (bm *BufferMgr) NewRing(size int) *Ring {
+	return &Ring{size: max(min(size, len(bm.bufferpool)/4), 1)}
+}
+
+// ringBuffer returns the buffer of r to read a block into. While the ring is smaller
+// than its size, it grows with a buffer of the pool that was never used, or else with
+// the one chosen by the replacement policy. Then the next unpinned buffer of the ring
+// is reused. Returns nil if every buffer of the ring is pinned, or holds a block
+// read ahead that wasn't pinned yet.
+// The buffer manager must be locked.
+func (bm *BufferMgr) ringBuffer(r *Ring) *Buffer {
+	r.buffers = slices.DeleteFunc(r.buffers, func(b *Buffer) bool { return b.ring != r })
+	if len(r.buffers) < r.size {
+		b := bm.freshBuffer()
+		if b == nil {
+			b = bm.chooseUnpinnedBuffer()
+		}
+		if b != nil && b.ring != r {
+			r.buffers = append(r.buffers, b)
+		}
+		return b
+	}
+	for range r.buffers {
+		b := r.buffers[r.next%len(r.buffers)]
+		r.next = (r.next + 1) % len(r.buffers)
+		if !b.IsPinned() && !bm.prefetched[b] {
+			return b
+		}
+	}
+	return nil
+}
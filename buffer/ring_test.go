@@ -0,0 +1,60 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+func TestRing(t *testing.T) {
+	fm, lm := newTestMgrs(t, 0)
+	for i := 0; i < 4; i++ {
+		fm.Append("hotfile")
+	}
+	for i := 0; i < 40; i++ {
+		fm.Append("bigfile")
+	}
+
+	for _, useRing := range []bool{false, true} {
+		bm := NewBufferMgr(fm, lm, 16, WithReplacement(LRU))
+		pin := func(blk *file.BlockId, ring *Ring) {
+			t.Helper()
+			buff, err := bm.PinInRing(blk, ring, MAX_TIME)
+			if err != nil {
+				t.Fatalf("PinInRing(%v): %v", blk, err)
+			}
+			bm.Unpin(buff)
+		}
+		for i := 0; i < 4; i++ {
+			pin(file.NewBlockId("hotfile", i), nil)
+		}
+
+		var ring *Ring
+		if useRing {
+			ring = bm.NewRing(RING_SIZE)
+		}
+		for i := 0; i < 40; i++ {
+			pin(file.NewBlockId("bigfile", i), ring)
+			if i == 20 {
+				// a block of the ring used by another pin is left in the pool
+				pin(file.NewBlockId("bigfile", i), nil)
+			}
+		}
+		bm.ResetStats()
+		for i := 0; i < 4; i++ {
+			pin(file.NewBlockId("hotfile", i), nil)
+		}
+		pin(file.NewBlockId("bigfile", 20), nil)
+
+		hits := bm.Stats().Hits
+		if useRing && hits != 5 {
+			t.Errorf("scan in a ring: %d hits on the hot blocks and the shared block, want 5", hits)
+		}
+		if !useRing && hits != 0 {
+			t.Errorf("scan without a ring: %d hits on the hot blocks and the shared block, want 0", hits)
+		}
+		if useRing && len(ring.buffers) != 4 {
+			t.Errorf("ring has %d buffers, want a quarter of the pool", len(ring.buffers))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package buffer
+
+import "time"
+
+// Stats is a snapshot of the activity of the buffer pool.
+type Stats struct {
+	Pins         int64         // calls to Pin that pinned a buffer
+	Hits         int64         // pins of a block already in the pool
+	Misses       int64         // pins that read their block into a buffer
+	Evictions    int64         // blocks replaced in the pool
+	DirtyFlushes int64         // modified pages written to disk
+	PinWaits     int64         // pins that waited for a buffer to become available
+	PinWaitTime  time.Duration // total time spent waiting for a buffer
+	Prefetches   int64         // blocks read ahead
+	Available    int           // unpinned buffers
+	Buffers      int           // size of the pool
+}
+
+// HitRatio returns the fraction of the pins that found their block in the pool.
+func (s Stats) HitRatio() float64 {
+	if s.Pins == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Pins)
+}
+
+// Stats returns a snapshot of the buffer pool counters, accumulated since
+// the buffer manager was created or its counters were reset.
+func (bm *BufferMgr) Stats() Stats {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	s := bm.stats
+	s.Available = bm.numAvailable
+	s.Buffers = len(bm.bufferpool)
+	return s
+}
+
+// ResetStats resets the buffer pool counters.
+func (bm *BufferMgr) ResetStats() {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.stats = Stats{}
+}
@@ -0,0 +1,53 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+func TestBufferMgrStats(t *testing.T) {
+	fm, lm := newTestMgrs(t, 3)
+	bm := NewBufferMgr(fm, lm, 2, WithPinTimeout(10*time.Millisecond))
+
+	pin := func(blknum int) *Buffer {
+		t.Helper()
+		buff, err := bm.Pin(file.NewBlockId("testfile", blknum))
+		if err != nil {
+			t.Fatalf("Pin(%d): %v", blknum, err)
+		}
+		return buff
+	}
+
+	b0 := pin(0)
+	b0.SetModified(1, -1)
+	bm.Unpin(b0)
+	bm.Unpin(pin(0))
+	b1 := pin(1)
+	b2 := pin(2) // evicts the dirty block 0
+	if _, err := bm.Pin(file.NewBlockId("testfile", 0)); !errors.Is(err, ErrBufferAbort) {
+		t.Fatalf("Pin with every buffer pinned: got %v, want ErrBufferAbort", err)
+	}
+
+	stats := bm.Stats()
+	want := Stats{Pins: 4, Hits: 1, Misses: 3, Evictions: 1, DirtyFlushes: 1, PinWaits: 1, Available: 0, Buffers: 2}
+	if stats.PinWaitTime < 10*time.Millisecond {
+		t.Errorf("PinWaitTime = %v, want at least the pin timeout", stats.PinWaitTime)
+	}
+	stats.PinWaitTime = 0
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+	if ratio := stats.HitRatio(); ratio != 0.25 {
+		t.Errorf("HitRatio() = %v, want 0.25", ratio)
+	}
+
+	bm.Unpin(b1)
+	bm.ResetStats()
+	if stats, want := bm.Stats(), (Stats{Available: 1, Buffers: 2}); stats != want {
+		t.Errorf("Stats() after reset = %+v, want %+v", stats, want)
+	}
+	bm.Unpin(b2)
+}
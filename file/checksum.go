@@ -0,0 +1,43 @@
+package file
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// checksumSize is the number of bytes appended to every block on disk
+// when checksums are enabled.
+const checksumSize = 4
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptBlockError is returned by FileMgr.Read when the checksum stored
+// with a block does not match its contents, e.g. after a torn write or a bit flip.
+type CorruptBlockError struct {
+	Blk      BlockId
+	Stored   uint32
+	Computed uint32
+}
+
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("corrupt block %v of file '%v': stored checksum %08x, computed %08x",
+		e.Blk.Blknum, e.Blk.Filename, e.Stored, e.Computed)
+}
+
+// stampChecksum computes the checksum of the first len(b)-checksumSize bytes of b
+// and stores it in the trailing checksumSize bytes.
+func stampChecksum(b []byte) {
+	n := len(b) - checksumSize
+	Encoding.PutUint32(b[n:], crc32.Checksum(b[:n], crcTable))
+}
+
+// verifyChecksum checks the trailing checksum of b against its contents.
+func verifyChecksum(blk *BlockId, b []byte) error {
+	n := len(b) - checksumSize
+	stored := Encoding.Uint32(b[n:])
+	computed := crc32.Checksum(b[:n], crcTable)
+	if stored != computed {
+		return &CorruptBlockError{Blk: *blk, Stored: stored, Computed: computed}
+	}
+	return nil
+}
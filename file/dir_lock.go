@@ -0,0 +1,66 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockFile is the name of the file in the database directory that is locked
+// by every FileMgr using the directory.
+const lockFile = "cefdb.lock"
+
+var (
+	// ErrLocked is returned by NewFileMgr when another process has the database open in a conflicting mode.
+	ErrLocked = errors.New("database directory is locked by another process")
+	// ErrReadOnly is returned by operations that would modify a database opened read-only.
+	ErrReadOnly = errors.New("database is opened read-only")
+)
+
+// Locker is implemented by storages that can be locked against concurrent use by other processes.
+type Locker interface {
+	// Lock locks the storage, exclusively unless shared is true.
+	// Shared locks may be held by several processes at once.
+	Lock(shared bool) error
+	// Unlock releases the lock taken by Lock.
+	Unlock() error
+}
+
+// WithReadOnly opens the database read-only. Several read-only FileMgrs may use
+// the same directory at once, but not alongside a writable one.
+// Temporary files are not cleaned up and every modification fails with ErrReadOnly.
+func WithReadOnly() Option {
+	return func(fm *FileMgr) {
+		fm.readOnly = true
+	}
+}
+
+// Lock takes an advisory lock on the lock file of the directory.
+func (s *OSStorage) Lock(shared bool) error {
+	if s.lock != nil {
+		return fmt.Errorf("database directory '%v' is already locked", s.dir)
+	}
+	path := filepath.Join(s.dir, lockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("opening lock file '%v': %w", path, err)
+	}
+	if err := lockFileHandle(f, shared); err != nil {
+		f.Close()
+		return fmt.Errorf("locking database directory '%v': %w", s.dir, err)
+	}
+	s.lock = f
+	return nil
+}
+
+// Unlock releases the lock on the directory.
+func (s *OSStorage) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+	// Closing the file releases the lock.
+	err := s.lock.Close()
+	s.lock = nil
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+// lockFileHandle is a no-op on platforms without flock:
+// the database directory is not protected against concurrent use.
+func lockFileHandle(f *os.File, shared bool) error {
+	return nil
+}
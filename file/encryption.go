@@ -0,0 +1,161 @@
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync/atomic"
+)
+
+// keyCheckFile holds a single known block, encrypted with the database key.
+// It lets NewFileMgr reject a wrong key before any data is read.
+const keyCheckFile = "cefdb.keycheck"
+
+var keyCheckMagic = []byte("CefDB encryption key check")
+
+var (
+	// ErrWrongKey is returned when an encrypted database is opened with a key it was not created with.
+	ErrWrongKey = errors.New("wrong encryption key")
+	// ErrKeyRequired is returned when an encrypted database is opened without a key.
+	ErrKeyRequired = errors.New("database is encrypted, a key is required")
+	// ErrNotEncrypted is returned when an existing plaintext database is opened with a key.
+	ErrNotEncrypted = errors.New("database is not encrypted")
+	// ErrDecryption is returned when a block fails authentication, either because
+	// it was tampered with or because it was written with another key.
+	ErrDecryption = errors.New("block failed authentication")
+)
+
+// WithEncryption encrypts every block with AES-GCM under key, which must be 16, 24 or 32 bytes long.
+// Each block is authenticated together with its BlockId, so blocks can't be moved around undetected.
+// The nonce of a block write is a random 64-bit prefix, drawn when the database is opened
+// and again after every 2^32 writes, followed by the number of writes made with the prefix.
+// Copies of a database opened with the same key, such as a restored backup or a standby,
+// draw their own prefixes: a nonce is only used twice if two prefixes collide, which stays
+// negligible while the key serves fewer than 2^32 prefixes, that is 2^64 block writes.
+// Keys should be rotated long before that.
+func WithEncryption(key []byte) Option {
+	return func(fm *FileMgr) {
+		fm.key = slices.Clone(key)
+	}
+}
+
+// initEncryption builds the block cipher from the configured key and checks
+// that it matches the key the database was created with.
+func (fm *FileMgr) initEncryption(files []string) error {
+	hasKeyCheck := slices.Contains(files, keyCheckFile)
+	if fm.key == nil {
+		if hasKeyCheck {
+			return ErrKeyRequired
+		}
+		return nil
+	}
+
+	source, err := newNonceSource()
+	if err != nil {
+		return err
+	}
+	fm.nonces.Store(source)
+
+	block, err := aes.NewCipher(fm.key)
+	if err != nil {
+		return fmt.Errorf("creating cipher: %w", err)
+	}
+	fm.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("creating cipher: %w", err)
+	}
+
+	blk := NewBlockId(keyCheckFile, 0)
+	p := NewPage(fm.blockSize)
+	if !hasKeyCheck {
+		if len(files) > 0 {
+			return ErrNotEncrypted
+		}
+		if _, err := fm.Append(keyCheckFile); err != nil {
+			return err
+		}
+		copy(p.Contents(), keyCheckMagic)
+		return fm.Write(blk, p)
+	}
+
+	if err := fm.Read(blk, p); err != nil {
+		if errors.Is(err, ErrDecryption) {
+			return ErrWrongKey
+		}
+		return err
+	}
+	if !slices.Equal(p.Contents()[:len(keyCheckMagic)], keyCheckMagic) {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// encryptionOverhead is the number of bytes encryption adds to each block.
+func (fm *FileMgr) encryptionOverhead() int {
+	if fm.aead == nil {
+		return 0
+	}
+	return fm.aead.NonceSize() + fm.aead.Overhead()
+}
+
+// nonceSource hands out the nonces of block writes: a random prefix followed by a counter.
+type nonceSource struct {
+	prefix [8]byte
+	sealed atomic.Uint64 // nonces handed out
+}
+
+func newNonceSource() (*nonceSource, error) {
+	s := &nonceSource{}
+	if _, err := rand.Read(s.prefix[:]); err != nil {
+		return nil, fmt.Errorf("generating nonce prefix: %w", err)
+	}
+	return s, nil
+}
+
+// nextNonce writes the next nonce into nonce, which must be 12 bytes long,
+// drawing a new prefix once the counter of the current one is exhausted.
+func (fm *FileMgr) nextNonce(nonce []byte) error {
+	for {
+		s := fm.nonces.Load()
+		if n := s.sealed.Add(1); n <= math.MaxUint32+1 {
+			copy(nonce, s.prefix[:])
+			Encoding.PutUint32(nonce[len(s.prefix):], uint32(n-1))
+			return nil
+		}
+		next, err := newNonceSource()
+		if err != nil {
+			return err
+		}
+		fm.nonces.CompareAndSwap(s, next)
+	}
+}
+
+// seal encrypts the page into dst, which must be blockSize+encryptionOverhead bytes long.
+func (fm *FileMgr) seal(blk *BlockId, p *Page, dst []byte) error {
+	nonce := dst[:fm.aead.NonceSize()]
+	if err := fm.nextNonce(nonce); err != nil {
+		return err
+	}
+	fm.aead.Seal(dst[len(nonce):len(nonce)], nonce, p.Contents(), blockAAD(blk))
+	return nil
+}
+
+// open decrypts src, as produced by seal, into the page.
+func (fm *FileMgr) open(blk *BlockId, src []byte, p *Page) error {
+	nonce := src[:fm.aead.NonceSize()]
+	if _, err := fm.aead.Open(p.Contents()[:0], nonce, src[len(nonce):], blockAAD(blk)); err != nil {
+		return fmt.Errorf("decrypting block %v of file '%v': %w", blk.Blknum, blk.Filename, ErrDecryption)
+	}
+	return nil
+}
+
+// blockAAD binds a sealed block to its location.
+func blockAAD(blk *BlockId) []byte {
+	aad := make([]byte, 8, 8+len(blk.Filename))
+	Encoding.PutUint64(aad, uint64(blk.Blknum))
+	return append(aad, blk.Filename...)
+}
@@ -0,0 +1,134 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "fileEncryption")
+	os.RemoveAll(tempDir) //clean up any previous runs
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	fm, err := NewFileMgr(tempDir, 128, WithEncryption(key), WithChecksums())
+	if err != nil {
+		t.Fatalf("NewFileMgr error = %v", err)
+	}
+
+	filename := "secret.tbl"
+	secret := "top secret value"
+	blk, err := fm.Append(filename)
+	if err != nil {
+		t.Fatalf("fm.Append(%q) error = %v", filename, err)
+	}
+	p := NewPage(fm.BlockSize())
+	p.SetString(0, secret)
+	if err := fm.Write(blk, p); err != nil {
+		t.Fatalf("fm.Write(%v, page) error = %v", blk, err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tempDir, filename))
+	if err != nil {
+		t.Fatalf("os.ReadFile error = %v", err)
+	}
+	if bytes.Contains(raw, []byte(secret)) {
+		t.Errorf("%q is stored in plaintext", filename)
+	}
+
+	// reopen with the right key
+	fm.Close()
+	fm, err = NewFileMgr(tempDir, 128, WithEncryption(key), WithChecksums())
+	if err != nil {
+		t.Fatalf("NewFileMgr with the right key error = %v", err)
+	}
+	p = NewPage(fm.BlockSize())
+	if err := fm.Read(blk, p); err != nil {
+		t.Fatalf("fm.Read(%v, page) error = %v", blk, err)
+	}
+	if s, _ := p.GetString(0); s != secret {
+		t.Errorf("GetString(0) returned %q, expected %q", s, secret)
+	}
+
+	// a block copied to another position fails authentication
+	if _, err := fm.Append(filename); err != nil {
+		t.Fatalf("fm.Append(%q) error = %v", filename, err)
+	}
+	raw, _ = os.ReadFile(filepath.Join(tempDir, filename))
+	blockLen := len(raw) / 2
+	copy(raw[blockLen:], raw[:blockLen])
+	os.WriteFile(filepath.Join(tempDir, filename), raw, 0666)
+	if err := fm.Read(NewBlockId(filename, 1), p); !errors.Is(err, ErrDecryption) {
+		t.Errorf("reading a moved block: error = %v, expected %v", err, ErrDecryption)
+	}
+
+	// wrong or missing keys are rejected up front
+	fm.Close()
+	wrongKey := []byte("fedcba9876543210fedcba9876543210")
+	if _, err := NewFileMgr(tempDir, 128, WithEncryption(wrongKey), WithChecksums()); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("NewFileMgr with a wrong key error = %v, expected %v", err, ErrWrongKey)
+	}
+	if _, err := NewFileMgr(tempDir, 128, WithChecksums()); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("NewFileMgr without a key error = %v, expected %v", err, ErrKeyRequired)
+	}
+
+	plainDir := filepath.Join(os.TempDir(), "filePlaintext")
+	os.RemoveAll(plainDir)
+	plain, _ := NewFileMgr(plainDir, 128)
+	plain.Append(filename)
+	plain.Close()
+	if _, err := NewFileMgr(plainDir, 128, WithEncryption(key)); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("NewFileMgr on a plaintext database error = %v, expected %v", err, ErrNotEncrypted)
+	}
+}
+
+func TestEncryptionNonces(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "fileNonces")
+	copyDir := filepath.Join(os.TempDir(), "fileNoncesCopy")
+	os.RemoveAll(tempDir) //clean up any previous runs
+	os.RemoveAll(copyDir)
+	key := []byte("0123456789abcdef")
+	filename := "secret.tbl"
+
+	fm, err := NewFileMgr(tempDir, 128, WithEncryption(key))
+	if err != nil {
+		t.Fatalf("NewFileMgr error = %v", err)
+	}
+	fm.Append(filename)
+	fm.Close()
+	// a copy of the database, as a backup or a standby would make
+	os.MkdirAll(copyDir, 0755)
+	for _, name := range []string{keyCheckFile, filename} {
+		b, _ := os.ReadFile(filepath.Join(tempDir, name))
+		os.WriteFile(filepath.Join(copyDir, name), b, 0666)
+	}
+
+	seen := make(map[string]bool)
+	writeBlock := func(fm *FileMgr, dir string) {
+		t.Helper()
+		if err := fm.Write(NewBlockId(filename, 0), NewPage(fm.BlockSize())); err != nil {
+			t.Fatalf("fm.Write error = %v", err)
+		}
+		raw, _ := os.ReadFile(filepath.Join(dir, filename))
+		nonce := string(raw[:fm.aead.NonceSize()])
+		if seen[nonce] {
+			t.Errorf("nonce %x was used twice", nonce)
+		}
+		seen[nonce] = true
+	}
+	for _, dir := range []string{tempDir, copyDir} {
+		fm, err := NewFileMgr(dir, 128, WithEncryption(key))
+		if err != nil {
+			t.Fatalf("NewFileMgr(%q) error = %v", dir, err)
+		}
+		writeBlock(fm, dir)
+		writeBlock(fm, dir)
+		// the counter of a prefix is exhausted: a new prefix is drawn
+		fm.nonces.Load().sealed.Store(math.MaxUint32 + 1)
+		writeBlock(fm, dir)
+		fm.Close()
+	}
+}
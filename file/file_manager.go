@@ -1,12 +1,12 @@
 package file
 
 import (
+	"container/list"
+	"crypto/cipher"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type BlockId struct {
@@ -19,157 +19,304 @@ func NewBlockId(filename string, blknum int) *BlockId {
 }
 
 type FileMgr struct {
-	dbDirectory string
-	blockSize   int
-	isNew       bool
-	openFiles   map[string]*os.File
-	sync.Mutex
+	storage      Storage
+	blockSize    int
+	checksums    bool
+	key          []byte
+	aead         cipher.AEAD
+	nonces       atomic.Pointer[nonceSource]
+	isNew        bool
+	readOnly     bool
+	maxOpenFiles int
+	openFiles    map[string]*openFile
+	lru          *list.List           // open files, most recently used first
+	closing      map[string]*openFile // files being synced and closed outside of the lock
+	changed      *sync.Cond           // broadcast when a file stops being in use or closing
+	closed       bool
+	stats        fileStats
+	sync.Mutex   // guards openFiles, lru, closing and closed
 }
 
-func dirExists(path string) bool {
-	info, err := os.Stat(path)
-	if err != nil {
-		return false
+// Option configures optional FileMgr behaviour.
+type Option func(*FileMgr)
+
+// WithChecksums stores a checksum alongside every block and verifies it on Read.
+// A database must always be opened with the same block format it was created with.
+func WithChecksums() Option {
+	return func(fm *FileMgr) {
+		fm.checksums = true
 	}
-	return info.IsDir()
 }
 
-// NewFileMgr creates a new FileMgr.
-func NewFileMgr(dbDirectory string, blockSize int) (*FileMgr, error) {
-	fm := &FileMgr{
-		dbDirectory: dbDirectory,
-		blockSize:   blockSize,
-		openFiles:   make(map[string]*os.File),
+// WithMaxOpenFiles caps the number of files kept open at once.
+// The least recently used files are closed, after being synced, to stay below the cap.
+// Files in use by an ongoing operation are never closed, so the cap may be briefly exceeded.
+func WithMaxOpenFiles(n int) Option {
+	return func(fm *FileMgr) {
+		fm.maxOpenFiles = n
 	}
+}
 
-	// Check if the directory exists
-	_, err := os.Stat(dbDirectory)
-	dirExists := err == nil
-	fm.isNew = !dirExists
+// NewFileMgr creates a new FileMgr storing its files in dbDirectory.
+// The directory is locked until Close so that no other process can use it concurrently.
+func NewFileMgr(dbDirectory string, blockSize int, opts ...Option) (*FileMgr, error) {
+	var config FileMgr
+	for _, opt := range opts {
+		opt(&config)
+	}
+	newStorage := NewOSStorage
+	if config.readOnly {
+		newStorage = NewReadOnlyOSStorage
+	}
+	storage, err := newStorage(dbDirectory)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileMgrWithStorage(storage, blockSize, opts...)
+}
+
+// NewFileMgrWithStorage creates a new FileMgr on top of the given storage.
+// If the storage is a Locker, it is locked until Close.
+func NewFileMgrWithStorage(storage Storage, blockSize int, opts ...Option) (fm *FileMgr, err error) {
+	fm = &FileMgr{
+		storage:   storage,
+		blockSize: blockSize,
+		isNew:     storage.IsNew(),
+		openFiles: make(map[string]*openFile),
+		lru:       list.New(),
+		closing:   make(map[string]*openFile),
+	}
+	fm.changed = sync.NewCond(&fm.Mutex)
+	for _, opt := range opts {
+		opt(fm)
+	}
 
-	// Create the directory if the database is new
-	if fm.isNew {
-		if err := os.MkdirAll(dbDirectory, 0777); err != nil {
-			return nil, fmt.Errorf("creating database directory '%v': %w", dbDirectory, err)
+	if locker, ok := storage.(Locker); ok {
+		if err := locker.Lock(fm.readOnly); err != nil {
+			return nil, err
 		}
+		defer func() {
+			if err != nil {
+				locker.Unlock()
+			}
+		}()
 	}
 
 	// Remove any leftover temporary tables
-	files, err := os.ReadDir(dbDirectory)
+	files, err := storage.List()
 	if err != nil {
-		return nil, fmt.Errorf("reading directory '%v': %w", dbDirectory, err)
+		return nil, err
 	}
+	var remaining []string
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "temp") {
-			tempFilePath := filepath.Join(dbDirectory, file.Name())
-			if err := os.Remove(tempFilePath); err != nil {
-				fmt.Printf("warning: could not delete temporary file '%v': %v\n", tempFilePath, err)
+		if strings.HasPrefix(file, "temp") && !fm.readOnly {
+			if err := storage.Remove(file); err != nil {
+				fmt.Printf("warning: could not delete temporary file '%v': %v\n", file, err)
 			}
+		} else {
+			remaining = append(remaining, file)
 		}
 	}
+
+	if err := fm.initEncryption(remaining); err != nil {
+		return nil, err
+	}
 	return fm, nil
 }
 
 // Read reads a block from the specified BlockId into the Page.
 func (fm *FileMgr) Read(blk *BlockId, p *Page) error {
-	fm.Lock()
-	defer fm.Unlock()
-
-	file, err := fm.getFile(blk.Filename)
+	file, err := fm.acquire(blk.Filename)
 	if err != nil {
 		return fmt.Errorf("getting file '%v': %w", blk.Filename, err)
 	}
+	defer fm.release(file)
 
-	offset := int64(blk.Blknum) * int64(fm.blockSize)
-	_, err = file.Seek(offset, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("seeking to offset %d in file '%v': %w", offset, blk.Filename, err)
-	}
-
-	_, err = io.ReadFull(file, p.Contents())
+	offset := int64(blk.Blknum) * int64(fm.physBlockSize())
+	b := make([]byte, fm.physBlockSize())
+	_, err = file.ReadAt(b, offset)
 	if err != nil {
 		return fmt.Errorf("reading block %v from file '%v': %v", blk, blk.Filename, err)
 	}
+	fm.stats.count(blk.Filename, 1, 0)
 
-	return nil
+	return fm.decodeBlock(blk, b, p)
 }
 
 // Write writes the contents of the Page to the specified BlockId.
+// The write is not durable until Sync is called for the file.
 func (fm *FileMgr) Write(blk *BlockId, p *Page) error {
-	fm.Lock()
-	defer fm.Unlock()
-
-	file, err := fm.getFile(blk.Filename)
+	if fm.readOnly {
+		return fmt.Errorf("writing block %v: %w", blk, ErrReadOnly)
+	}
+	file, err := fm.acquire(blk.Filename)
 	if err != nil {
 		return fmt.Errorf("getting file '%v': %v", blk.Filename, err)
 	}
+	defer fm.release(file)
 
-	offset := int64(blk.Blknum) * int64(fm.blockSize)
-	_, err = file.Seek(offset, io.SeekStart)
+	offset := int64(blk.Blknum) * int64(fm.physBlockSize())
+	b, err := fm.encodeBlock(blk, p)
 	if err != nil {
-		return fmt.Errorf("seeking to offset %d in file '%v': %w", offset, blk.Filename, err)
+		return err
 	}
-
-	_, err = file.Write(p.Contents())
+	_, err = file.WriteAt(b, offset)
 	if err != nil {
 		return fmt.Errorf("writing block %v to file '%v': %w", blk, blk.Filename, err)
 	}
+	file.dirty.Store(true)
+	fm.stats.count(blk.Filename, 0, 1)
 
-	// Ensure the write is persisted to disk
-	if err := file.Sync(); err != nil {
-		return fmt.Errorf("syncing file '%v': %w", blk.Filename, err)
+	return nil
+}
+
+// Sync makes all previous writes to the specified file durable.
+// Concurrent callers share a single sync of the underlying storage where possible.
+func (fm *FileMgr) Sync(filename string) error {
+	file, err := fm.acquire(filename)
+	if err != nil {
+		return fmt.Errorf("getting file '%v': %w", filename, err)
 	}
+	defer fm.release(file)
 
+	file.syncMu.Lock()
+	defer file.syncMu.Unlock()
+	if !file.dirty.Swap(false) {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		file.dirty.Store(true)
+		return fmt.Errorf("syncing file '%v': %w", filename, err)
+	}
 	return nil
 }
 
 // Append appends a new block to the specified file and returns the BlockId of the new block.
+// The new block is durable when Append returns.
 func (fm *FileMgr) Append(filename string) (*BlockId, error) {
-	fm.Lock()
-	defer fm.Unlock()
-
-	file, err := fm.getFile(filename)
+	if fm.readOnly {
+		return nil, fmt.Errorf("appending block to file '%v': %w", filename, ErrReadOnly)
+	}
+	file, err := fm.acquire(filename)
 	if err != nil {
 		return nil, fmt.Errorf("getting file '%v': %w", filename, err)
 	}
+	defer fm.release(file)
 
-	lastOffset, err := file.Seek(0, io.SeekEnd)
+	file.appendMu.Lock()
+	lastOffset, err := file.Length()
 	if err != nil {
-		return nil, fmt.Errorf("failed seeking to end of file '%v': %v", filename, err)
+		file.appendMu.Unlock()
+		return nil, fmt.Errorf("getting length of file '%v': %v", filename, err)
 	}
 
-	newBlockId := int(int(lastOffset) / fm.blockSize)
+	blk := &BlockId{Filename: filename, Blknum: int(int(lastOffset) / fm.physBlockSize())}
 	// Create a buffer of zeros for the new block
-	b := make([]byte, fm.blockSize)
-	_, err = file.Write(b)
+	b, err := fm.encodeBlock(blk, NewPage(fm.blockSize))
+	if err == nil {
+		_, err = file.WriteAt(b, int64(blk.Blknum)*int64(fm.physBlockSize()))
+	}
+	file.appendMu.Unlock()
 	if err != nil {
 		return nil, fmt.Errorf("appending block to file '%v': %v", filename, err)
 	}
+	file.dirty.Store(true)
+	fm.stats.count(filename, 0, 1)
 
-	// Ensure the write is persisted to disk
-	if err := file.Sync(); err != nil {
-		return nil, fmt.Errorf("syncing file '%v': %v", filename, err)
+	// Ensure the new block is persisted to disk
+	if err := fm.Sync(filename); err != nil {
+		return nil, err
 	}
 
-	return &BlockId{Filename: filename, Blknum: newBlockId}, nil
+	return blk, nil
 }
 
 // Length returns the number of blocks in the specified file.
 func (fm *FileMgr) Length(filename string) (int, error) {
+	file, err := fm.acquire(filename)
+	if err != nil {
+		return 0, fmt.Errorf("getting file '%v': %w", filename, err)
+	}
+	defer fm.release(file)
+
+	size, err := file.Length()
+	if err != nil {
+		return 0, fmt.Errorf("getting length of file '%v': %w", filename, err)
+	}
+
+	return int(size / int64(fm.physBlockSize())), nil
+}
+
+// Truncate shrinks the specified file to its first nblocks blocks.
+func (fm *FileMgr) Truncate(filename string, nblocks int) error {
+	if fm.readOnly {
+		return fmt.Errorf("truncating file '%v': %w", filename, ErrReadOnly)
+	}
+	file, err := fm.acquire(filename)
+	if err != nil {
+		return fmt.Errorf("getting file '%v': %w", filename, err)
+	}
+	defer fm.release(file)
+
+	file.appendMu.Lock()
+	err = file.Truncate(int64(nblocks) * int64(fm.physBlockSize()))
+	file.appendMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("truncating file '%v' to %d blocks: %w", filename, nblocks, err)
+	}
+	file.dirty.Store(true)
+	return fm.Sync(filename)
+}
+
+// Remove closes and deletes the specified file.
+func (fm *FileMgr) Remove(filename string) error {
+	if fm.readOnly {
+		return fmt.Errorf("removing file '%v': %w", filename, ErrReadOnly)
+	}
 	fm.Lock()
 	defer fm.Unlock()
+	fm.waitClosing(filename)
+	if fm.closed {
+		return ErrClosed
+	}
+	if file, ok := fm.openFiles[filename]; ok {
+		if file.refs > 0 {
+			return fmt.Errorf("removing file '%v': %w", filename, ErrFileInUse)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("closing file '%v': %w", filename, err)
+		}
+		fm.lru.Remove(file.elem)
+		delete(fm.openFiles, filename)
+	}
+	if err := fm.storage.Remove(filename); err != nil {
+		return fmt.Errorf("removing file '%v': %w", filename, err)
+	}
+	return nil
+}
 
-	file, err := fm.getFile(filename)
+// Files returns the names of all files of the database.
+func (fm *FileMgr) Files() ([]string, error) {
+	return fm.storage.List()
+}
+
+// CopyFile copies the blocks of the specified file to dst as they are stored on disk,
+// i.e. still encrypted and checksummed, and syncs the copy.
+// Blocks appended while the copy is in progress may be left out.
+func (fm *FileMgr) CopyFile(filename string, dst Storage) error {
+	file, err := fm.acquire(filename)
 	if err != nil {
-		return 0, fmt.Errorf("getting file '%v': %w", filename, err)
+		return fmt.Errorf("getting file '%v': %w", filename, err)
 	}
+	defer fm.release(file)
 
-	fileInfo, err := file.Stat()
+	size, err := file.Length()
 	if err != nil {
-		return 0, fmt.Errorf("getting file info for '%v': %w", filename, err)
+		return fmt.Errorf("getting length of file '%v': %w", filename, err)
 	}
-
-	return int(fileInfo.Size() / int64(fm.blockSize)), nil
+	// only copy whole blocks, in case an append is in progress
+	size -= size % int64(fm.physBlockSize())
+	return copyStorageFile(file, size, dst, filename)
 }
 
 // IsNew returns true if the database directory was newly created.
@@ -177,21 +324,55 @@ func (fm *FileMgr) IsNew() bool {
 	return fm.isNew
 }
 
+// IsReadOnly returns true if the database was opened with WithReadOnly.
+func (fm *FileMgr) IsReadOnly() bool {
+	return fm.readOnly
+}
+
 // BlockSize returns the block size.
 func (fm *FileMgr) BlockSize() int {
 	return fm.blockSize
 }
 
-func (fm *FileMgr) getFile(filename string) (*os.File, error) {
-	if file, ok := fm.openFiles[filename]; ok {
-		return file, nil
+// physBlockSize returns the size a block occupies on disk,
+// which is larger than the page size when checksums or encryption are enabled.
+func (fm *FileMgr) physBlockSize() int {
+	size := fm.blockSize + fm.encryptionOverhead()
+	if fm.checksums {
+		size += checksumSize
 	}
+	return size
+}
 
-	filePath := filepath.Join(fm.dbDirectory, filename)
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return nil, fmt.Errorf("opening file '%v': %w", filePath, err)
+// encodeBlock returns the on-disk representation of the page stored at blk.
+func (fm *FileMgr) encodeBlock(blk *BlockId, p *Page) ([]byte, error) {
+	if !fm.checksums && fm.aead == nil {
+		return p.Contents(), nil
+	}
+	b := make([]byte, fm.physBlockSize())
+	if fm.aead != nil {
+		if err := fm.seal(blk, p, b); err != nil {
+			return nil, err
+		}
+	} else {
+		copy(b, p.Contents())
+	}
+	if fm.checksums {
+		stampChecksum(b)
+	}
+	return b, nil
+}
+
+// decodeBlock verifies the on-disk representation b of blk and copies it into the page.
+func (fm *FileMgr) decodeBlock(blk *BlockId, b []byte, p *Page) error {
+	if fm.checksums {
+		if err := verifyChecksum(blk, b); err != nil {
+			return err
+		}
 	}
-	fm.openFiles[filename] = file
-	return file, nil
+	if fm.aead != nil {
+		return fm.open(blk, b[:fm.blockSize+fm.encryptionOverhead()], p)
+	}
+	copy(p.Contents(), b[:fm.blockSize])
+	return nil
 }
@@ -1,8 +1,12 @@
 package file
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -39,7 +43,7 @@ func TestFileManager(t *testing.T) {
 	if err := fm.Read(blk1, p2); err != nil {
 		t.Fatalf("fm.Read(%v, page) error = %v", blk1, err)
 	}
-	actualStr := p2.GetString(offsetStr)
+	actualStr, _ := p2.GetString(offsetStr)
 	if actualStr != expectedStr {
 		t.Errorf("GetString(%d) returned %q, expected %q", offsetStr, actualStr, expectedStr)
 	}
@@ -63,8 +67,158 @@ func TestFileManager(t *testing.T) {
 	if err := fm.Read(blk2, p3); err != nil {
 		t.Fatalf("fm.Read(%v, page) error = %v", blk2, err)
 	}
-	actualInt := p3.GetInt(offsetInt)
+	actualInt, _ := p3.GetInt(offsetInt)
 	if actualInt != expectedInt {
 		t.Errorf("GetInt(%d) returned %d, expected %d", offsetInt, actualInt, expectedInt)
 	}
 }
+
+func TestFileManagerChecksums(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "fileChecksums")
+	os.RemoveAll(tempDir) //clean up any previous runs
+	blockSize := 128
+
+	fm, err := NewFileMgr(tempDir, blockSize, WithChecksums())
+	if err != nil {
+		t.Fatalf("NewFileMgr(%q, %d) error = %v", tempDir, blockSize, err)
+	}
+
+	filename := "toto"
+	blk, err := fm.Append(filename)
+	if err != nil {
+		t.Fatalf("fm.Append(%q) error = %v", filename, err)
+	}
+	p := NewPage(fm.BlockSize())
+	p.SetString(10, "checksummed")
+	if err := fm.Write(blk, p); err != nil {
+		t.Fatalf("fm.Write(%v, page) error = %v", blk, err)
+	}
+	if err := fm.Read(blk, NewPage(fm.BlockSize())); err != nil {
+		t.Fatalf("fm.Read(%v, page) error = %v", blk, err)
+	}
+
+	// flip a bit behind the file manager's back
+	path := filepath.Join(tempDir, filename)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error = %v", path, err)
+	}
+	raw[12] ^= 0x01
+	if err := os.WriteFile(path, raw, 0666); err != nil {
+		t.Fatalf("os.WriteFile(%q) error = %v", path, err)
+	}
+
+	err = fm.Read(blk, NewPage(fm.BlockSize()))
+	var corrupt *CorruptBlockError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("fm.Read(%v, page) error = %v, expected a CorruptBlockError", blk, err)
+	}
+	if corrupt.Blk != *blk {
+		t.Errorf("CorruptBlockError.Blk = %v, expected %v", corrupt.Blk, *blk)
+	}
+}
+
+// BenchmarkConcurrentWrites has concurrent writers, each on its own file, write pages
+// either syncing after every page (the old Write behaviour) or syncing once per batch
+// of pages, as BufferMgr.FlushAll does on commit.
+// The global-lock cases serialize the writes and syncs behind one mutex, as the FileMgr
+// used to, as a baseline for the per-file cases.
+func BenchmarkConcurrentWrites(b *testing.B) {
+	for _, locking := range []string{"global-lock", "per-file"} {
+		for _, batch := range []int{1, 16} {
+			b.Run(fmt.Sprintf("%s/sync-every-%d", locking, batch), func(b *testing.B) {
+				tempDir := filepath.Join(os.TempDir(), "fileBenchmark")
+				os.RemoveAll(tempDir)
+				fm, err := NewFileMgr(tempDir, 4096)
+				if err != nil {
+					b.Fatalf("NewFileMgr error = %v", err)
+				}
+				var mu sync.Mutex
+				serialized := func(f func()) {
+					if locking == "global-lock" {
+						mu.Lock()
+						defer mu.Unlock()
+					}
+					f()
+				}
+				var writers atomic.Int64
+				b.SetParallelism(4)
+				b.RunParallel(func(pb *testing.PB) {
+					filename := fmt.Sprintf("bench%d", writers.Add(1))
+					for i := 0; i < batch; i++ {
+						fm.Append(filename)
+					}
+					p := NewPage(fm.BlockSize())
+					for i := 1; pb.Next(); i++ {
+						serialized(func() {
+							if err := fm.Write(NewBlockId(filename, i%batch), p); err != nil {
+								b.Errorf("fm.Write error = %v", err)
+							}
+							if i%batch == 0 {
+								fm.Sync(filename)
+							}
+						})
+					}
+					serialized(func() { fm.Sync(filename) })
+				})
+				fm.Close()
+			})
+		}
+	}
+}
+
+func TestFileManagerStats(t *testing.T) {
+	fm, err := NewFileMgrWithStorage(NewMemStorage(), 128)
+	if err != nil {
+		t.Fatalf("NewFileMgrWithStorage error = %v", err)
+	}
+	p := NewPage(fm.BlockSize())
+	for i := 0; i < 2; i++ {
+		if _, err := fm.Append("a"); err != nil {
+			t.Fatalf("fm.Append error = %v", err)
+		}
+	}
+	if err := fm.Write(NewBlockId("a", 1), p); err != nil {
+		t.Fatalf("fm.Write error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := fm.Read(NewBlockId("a", 0), p); err != nil {
+			t.Fatalf("fm.Read error = %v", err)
+		}
+	}
+	if _, err := fm.Append("b"); err != nil {
+		t.Fatalf("fm.Append error = %v", err)
+	}
+
+	stats := fm.Stats()
+	if want := (FileStats{BlockReads: 3, BlockWrites: 3}); stats["a"] != want {
+		t.Errorf("stats of a = %+v, want %+v", stats["a"], want)
+	}
+	if want := (FileStats{BlockWrites: 1}); stats["b"] != want {
+		t.Errorf("stats of b = %+v, want %+v", stats["b"], want)
+	}
+
+	fm.ResetStats()
+	if stats := fm.Stats(); len(stats) != 0 {
+		t.Errorf("stats after reset = %v, want none", stats)
+	}
+
+	// concurrent reads are all counted
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := NewPage(fm.BlockSize())
+			for i := 0; i < 50; i++ {
+				if err := fm.Read(NewBlockId("a", i%2), p); err != nil {
+					t.Errorf("fm.Read error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if want := (FileStats{BlockReads: 200}); fm.Stats()["a"] != want {
+		t.Errorf("stats of a after concurrent reads = %+v, want %+v", fm.Stats()["a"], want)
+	}
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MemStorage keeps files in memory. Its contents are lost when it is garbage collected,
+// which makes it suitable for throwaway databases and tests.
+type MemStorage struct {
+	files map[string]*memFile
+	sync.Mutex
+}
+
+// NewMemStorage creates an empty in-memory Storage.
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: make(map[string]*memFile)}
+}
+
+func (s *MemStorage) Open(filename string) (StorageFile, error) {
+	s.Lock()
+	defer s.Unlock()
+	f, ok := s.files[filename]
+	if !ok {
+		f = &memFile{}
+		s.files[filename] = f
+	}
+	return f, nil
+}
+
+func (s *MemStorage) Remove(filename string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.files[filename]; !ok {
+		return fmt.Errorf("removing file '%v': %w", filename, os.ErrNotExist)
+	}
+	delete(s.files, filename)
+	return nil
+}
+
+func (s *MemStorage) List() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	var names []string
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// IsNew always returns true: an in-memory storage never outlives its process.
+func (s *MemStorage) IsNew() bool {
+	return true
+}
+
+type memFile struct {
+	data []byte
+	sync.RWMutex
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	f.RLock()
+	defer f.RUnlock()
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if end := off + int64(len(b)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	return copy(f.data[off:], b), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Length() (int64, error) {
+	f.RLock()
+	defer f.RUnlock()
+	return int64(len(f.data)), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.Lock()
+	defer f.Unlock()
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package file
+
+import (
+	"testing"
+)
+
+func TestMemStorage(t *testing.T) {
+	storage := NewMemStorage()
+	if _, err := storage.Open("temp1"); err != nil {
+		t.Fatalf("storage.Open(%q) error = %v", "temp1", err)
+	}
+
+	fm, err := NewFileMgrWithStorage(storage, 64, WithChecksums())
+	if err != nil {
+		t.Fatalf("NewFileMgrWithStorage error = %v", err)
+	}
+	if !fm.IsNew() {
+		t.Errorf("IsNew() = false, expected an in-memory database to be new")
+	}
+	if names, _ := storage.List(); len(names) != 0 {
+		t.Errorf("List() = %v, expected temporary files to be removed", names)
+	}
+
+	filename := "toto"
+	for i := 0; i < 3; i++ {
+		if _, err := fm.Append(filename); err != nil {
+			t.Fatalf("fm.Append(%q) error = %v", filename, err)
+		}
+	}
+	if n, _ := fm.Length(filename); n != 3 {
+		t.Errorf("Length(%q) = %d, expected 3", filename, n)
+	}
+
+	blk := NewBlockId(filename, 2)
+	p1 := NewPage(fm.BlockSize())
+	p1.SetString(20, "in memory")
+	if err := fm.Write(blk, p1); err != nil {
+		t.Fatalf("fm.Write(%v, page) error = %v", blk, err)
+	}
+	p2 := NewPage(fm.BlockSize())
+	if err := fm.Read(blk, p2); err != nil {
+		t.Fatalf("fm.Read(%v, page) error = %v", blk, err)
+	}
+	if s, _ := p2.GetString(20); s != "in memory" {
+		t.Errorf("GetString(20) returned %q, expected %q", s, "in memory")
+	}
+
+	if err := fm.Read(NewBlockId(filename, 3), p2); err == nil {
+		t.Errorf("fm.Read past the end of %q should fail", filename)
+	}
+}
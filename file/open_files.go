@@ -0,0 +1,205 @@
+package file
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrClosed is returned by operations on a FileMgr that has been closed.
+	ErrClosed = errors.New("file manager is closed")
+	// ErrFileInUse is returned when closing or removing a file while an operation on it is in progress.
+	ErrFileInUse = errors.New("file is in use")
+)
+
+// openFile is a StorageFile opened by the FileMgr.
+// Blocks are read and written by position, so no lock is needed for them;
+// appends are serialized since they depend on the file length.
+type openFile struct {
+	StorageFile
+	name     string
+	refs     int           // ongoing operations, guarded by the FileMgr lock
+	elem     *list.Element // position in the FileMgr's LRU list
+	appendMu sync.Mutex
+	syncMu   sync.Mutex  // makes concurrent Sync callers wait for the one in flight
+	dirty    atomic.Bool // written since the last sync
+}
+
+// acquire returns the open file for filename, opening it if needed.
+// The file stays open until the matching call to release.
+func (fm *FileMgr) acquire(filename string) (*openFile, error) {
+	fm.Lock()
+	fm.waitClosing(filename)
+	if fm.closed {
+		fm.Unlock()
+		return nil, ErrClosed
+	}
+	if file, ok := fm.openFiles[filename]; ok {
+		file.refs++
+		fm.lru.MoveToFront(file.elem)
+		fm.Unlock()
+		return file, nil
+	}
+
+	f, err := fm.storage.Open(filename)
+	if err != nil {
+		fm.Unlock()
+		return nil, err
+	}
+	file := &openFile{StorageFile: f, name: filename, refs: 1}
+	file.elem = fm.lru.PushFront(file)
+	fm.openFiles[filename] = file
+	evicted := fm.evictFiles()
+	fm.Unlock()
+	fm.closeEvicted(evicted)
+	return file, nil
+}
+
+// release ends an operation started by acquire.
+func (fm *FileMgr) release(file *openFile) {
+	fm.Lock()
+	file.refs--
+	if file.refs == 0 {
+		fm.changed.Broadcast()
+	}
+	evicted := fm.evictFiles()
+	fm.Unlock()
+	fm.closeEvicted(evicted)
+}
+
+// waitClosing waits until filename isn't being closed, so that it isn't opened again
+// before its writes are synced. The FileMgr must be locked.
+func (fm *FileMgr) waitClosing(filename string) {
+	for fm.closing[filename] != nil {
+		fm.changed.Wait()
+	}
+}
+
+// evictFiles takes least recently used files out of the open files until at most
+// maxOpenFiles remain open, and returns them: they must be closed with closeEvicted
+// once the FileMgr is unlocked. The FileMgr must be locked.
+func (fm *FileMgr) evictFiles() []*openFile {
+	if fm.maxOpenFiles <= 0 {
+		return nil
+	}
+	var evicted []*openFile
+	for e := fm.lru.Back(); e != nil && len(fm.openFiles) > fm.maxOpenFiles; {
+		file := e.Value.(*openFile)
+		e = e.Prev()
+		if file.refs > 0 {
+			continue
+		}
+		fm.startClosing(file)
+		evicted = append(evicted, file)
+	}
+	return evicted
+}
+
+// closeEvicted closes the files returned by evictFiles.
+func (fm *FileMgr) closeEvicted(evicted []*openFile) {
+	for _, file := range evicted {
+		if err := fm.closeFile(file); err != nil {
+			fmt.Printf("warning: could not close file '%v': %v\n", file.name, err)
+		}
+	}
+}
+
+// startClosing takes a file that isn't in use out of the open files, so that it can be
+// closed by closeFile without holding the lock. The FileMgr must be locked.
+func (fm *FileMgr) startClosing(file *openFile) {
+	fm.lru.Remove(file.elem)
+	delete(fm.openFiles, file.name)
+	fm.closing[file.name] = file
+}
+
+// closeFile syncs and closes a file taken out of the open files by startClosing.
+// The FileMgr must not be locked. If the file can't be synced, it is left open.
+func (fm *FileMgr) closeFile(file *openFile) error {
+	var err error
+	if file.dirty.Load() {
+		if err = file.Sync(); err != nil {
+			err = fmt.Errorf("syncing file '%v': %w", file.name, err)
+		}
+	}
+	if err == nil {
+		if err = file.Close(); err != nil {
+			err = fmt.Errorf("closing file '%v': %w", file.name, err)
+		}
+	}
+
+	fm.Lock()
+	defer fm.Unlock()
+	delete(fm.closing, file.name)
+	if err != nil && file.dirty.Load() {
+		// keep the file, and its unsynced writes, for a later Sync
+		file.elem = fm.lru.PushBack(file)
+		fm.openFiles[file.name] = file
+	}
+	fm.changed.Broadcast()
+	return err
+}
+
+// CloseFile syncs and closes the specified file if it is open.
+// It is reopened by the next operation that needs it.
+func (fm *FileMgr) CloseFile(filename string) error {
+	fm.Lock()
+	fm.waitClosing(filename)
+	file, ok := fm.openFiles[filename]
+	if !ok {
+		fm.Unlock()
+		return nil
+	}
+	if file.refs > 0 {
+		fm.Unlock()
+		return fmt.Errorf("closing file '%v': %w", filename, ErrFileInUse)
+	}
+	fm.startClosing(file)
+	fm.Unlock()
+	return fm.closeFile(file)
+}
+
+// Close waits for the ongoing operations, syncs and closes every open file
+// and releases the directory lock.
+// The FileMgr can't be used afterwards: new operations fail with ErrClosed.
+func (fm *FileMgr) Close() error {
+	fm.Lock()
+	if fm.closed {
+		fm.Unlock()
+		return nil
+	}
+	fm.closed = true
+	for !fm.idle() {
+		fm.changed.Wait()
+	}
+	files := make([]*openFile, 0, len(fm.openFiles))
+	for _, file := range fm.openFiles {
+		fm.startClosing(file)
+		files = append(files, file)
+	}
+	fm.Unlock()
+
+	var errs []error
+	for _, file := range files {
+		errs = append(errs, fm.closeFile(file))
+	}
+	if locker, ok := fm.storage.(Locker); ok {
+		errs = append(errs, locker.Unlock())
+	}
+	return errors.Join(errs...)
+}
+
+// idle returns true if no file is in use or being closed. The FileMgr must be locked.
+func (fm *FileMgr) idle() bool {
+	if len(fm.closing) > 0 {
+		return false
+	}
+	for _, file := range fm.openFiles {
+		if file.refs > 0 {
+			return false
+		}
+	}
+	return true
+}
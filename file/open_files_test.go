@@ -0,0 +1,250 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenFiles(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "openfiles")
+	os.RemoveAll(tempDir) //clean up any previous runs
+
+	fm, err := NewFileMgr(tempDir, 64, WithMaxOpenFiles(2))
+	if err != nil {
+		t.Fatalf("NewFileMgr(%q) error = %v", tempDir, err)
+	}
+
+	// Write more files than may stay open, then read them all back.
+	for i := 0; i < 5; i++ {
+		filename := fmt.Sprintf("file%d", i)
+		blk, err := fm.Append(filename)
+		if err != nil {
+			t.Fatalf("fm.Append(%q) error = %v", filename, err)
+		}
+		p := NewPage(fm.BlockSize())
+		p.SetInt(0, i)
+		if err := fm.Write(blk, p); err != nil {
+			t.Fatalf("fm.Write(%v) error = %v", blk, err)
+		}
+		if n := len(fm.openFiles); n > 2 {
+			t.Errorf("%d files open, expected at most 2", n)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		p := NewPage(fm.BlockSize())
+		blk := NewBlockId(fmt.Sprintf("file%d", i), 0)
+		if err := fm.Read(blk, p); err != nil {
+			t.Fatalf("fm.Read(%v) error = %v", blk, err)
+		}
+		if v, _ := p.GetInt(0); v != i {
+			t.Errorf("block %v holds %d, expected %d", blk, v, i)
+		}
+	}
+
+	// Truncate
+	for i := 0; i < 3; i++ {
+		fm.Append("file0")
+	}
+	if err := fm.Truncate("file0", 2); err != nil {
+		t.Fatalf("fm.Truncate error = %v", err)
+	}
+	if n, _ := fm.Length("file0"); n != 2 {
+		t.Errorf("Length after Truncate = %d, expected 2", n)
+	}
+
+	// Remove
+	if err := fm.Remove("file1"); err != nil {
+		t.Fatalf("fm.Remove error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "file1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file1 still exists after Remove, Stat error = %v", err)
+	}
+
+	// Close
+	if err := fm.CloseFile("file0"); err != nil {
+		t.Fatalf("fm.CloseFile error = %v", err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("fm.Close error = %v", err)
+	}
+	if _, err := fm.Length("file0"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Length after Close error = %v, expected ErrClosed", err)
+	}
+}
+
+// slowSyncStorage is a MemStorage whose files block in Sync until unblock is closed.
+type slowSyncStorage struct {
+	*MemStorage
+	syncing chan string
+	unblock chan struct{}
+}
+
+type slowSyncFile struct {
+	StorageFile
+	name    string
+	storage *slowSyncStorage
+}
+
+func (s *slowSyncStorage) Open(filename string) (StorageFile, error) {
+	f, err := s.MemStorage.Open(filename)
+	return &slowSyncFile{StorageFile: f, name: filename, storage: s}, err
+}
+
+func (f *slowSyncFile) Sync() error {
+	f.storage.syncing <- f.name
+	<-f.storage.unblock
+	return f.StorageFile.Sync()
+}
+
+func TestOpenFilesSyncOutsideLock(t *testing.T) {
+	storage := &slowSyncStorage{MemStorage: NewMemStorage(), syncing: make(chan string, 10), unblock: make(chan struct{})}
+	fm, err := NewFileMgrWithStorage(storage, 64, WithMaxOpenFiles(1))
+	if err != nil {
+		t.Fatalf("NewFileMgrWithStorage error = %v", err)
+	}
+	file, err := fm.acquire("file0")
+	if err != nil {
+		t.Fatalf("acquire error = %v", err)
+	}
+	file.dirty.Store(true)
+	fm.release(file)
+
+	// opening file1 evicts file0, whose sync blocks
+	done := make(chan error)
+	go func() {
+		_, err := fm.Length("file1")
+		done <- err
+	}()
+	if name := <-storage.syncing; name != "file0" {
+		t.Fatalf("syncing %v, expected file0", name)
+	}
+	// other files can be opened meanwhile, but not file0
+	if _, err := fm.Length("file2"); err != nil {
+		t.Fatalf("Length(file2) error = %v", err)
+	}
+	reopened := make(chan error)
+	go func() {
+		_, err := fm.Length("file0")
+		reopened <- err
+	}()
+	select {
+	case <-reopened:
+		t.Fatalf("file0 was reopened before it was synced")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(storage.unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("Length(file1) error = %v", err)
+	}
+	if err := <-reopened; err != nil {
+		t.Fatalf("Length(file0) error = %v", err)
+	}
+
+	// Close waits for the ongoing operations
+	file, _ = fm.acquire("file0")
+	closed := make(chan error)
+	go func() {
+		closed <- fm.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatalf("Close returned while file0 was in use")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if _, err := fm.Length("file1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Length while closing error = %v, expected ErrClosed", err)
+	}
+	fm.release(file)
+	if err := <-closed; err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+}
+
+func TestMemStorageTruncate(t *testing.T) {
+	fm, err := NewFileMgrWithStorage(NewMemStorage(), 64, WithChecksums())
+	if err != nil {
+		t.Fatalf("NewFileMgrWithStorage error = %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		fm.Append("toto")
+	}
+	if err := fm.Truncate("toto", 1); err != nil {
+		t.Fatalf("fm.Truncate error = %v", err)
+	}
+	if n, _ := fm.Length("toto"); n != 1 {
+		t.Errorf("Length after Truncate = %d, expected 1", n)
+	}
+	if err := fm.Read(NewBlockId("toto", 0), NewPage(64)); err != nil {
+		t.Errorf("fm.Read after Truncate error = %v", err)
+	}
+	if err := fm.Remove("toto"); err != nil {
+		t.Errorf("fm.Remove error = %v", err)
+	}
+}
+
+func TestDirectoryLock(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "dirlock")
+	os.RemoveAll(tempDir) //clean up any previous runs
+
+	if _, err := NewFileMgr(tempDir, 64, WithReadOnly()); err == nil {
+		t.Errorf("NewFileMgr read-only on a missing directory succeeded")
+	}
+
+	fm, err := NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("NewFileMgr(%q) error = %v", tempDir, err)
+	}
+	blk, _ := fm.Append("toto")
+	p := NewPage(fm.BlockSize())
+	p.SetString(0, "hello")
+	fm.Write(blk, p)
+
+	if _, err := NewFileMgr(tempDir, 64); !errors.Is(err, ErrLocked) {
+		t.Errorf("second NewFileMgr error = %v, expected %v", err, ErrLocked)
+	}
+	if _, err := NewFileMgr(tempDir, 64, WithReadOnly()); !errors.Is(err, ErrLocked) {
+		t.Errorf("read-only NewFileMgr alongside a writer error = %v, expected %v", err, ErrLocked)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("fm.Close error = %v", err)
+	}
+
+	// readers coexist, but exclude writers
+	r1, err := NewFileMgr(tempDir, 64, WithReadOnly())
+	if err != nil {
+		t.Fatalf("read-only NewFileMgr error = %v", err)
+	}
+	r2, err := NewFileMgr(tempDir, 64, WithReadOnly())
+	if err != nil {
+		t.Fatalf("second read-only NewFileMgr error = %v", err)
+	}
+	if _, err := NewFileMgr(tempDir, 64); !errors.Is(err, ErrLocked) {
+		t.Errorf("NewFileMgr alongside readers error = %v, expected %v", err, ErrLocked)
+	}
+
+	p = NewPage(r1.BlockSize())
+	if err := r1.Read(blk, p); err != nil {
+		t.Fatalf("r1.Read(%v) error = %v", blk, err)
+	}
+	if s, _ := p.GetString(0); s != "hello" {
+		t.Errorf("GetString(0) = %q, expected %q", s, "hello")
+	}
+	if err := r1.Write(blk, p); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("r1.Write error = %v, expected %v", err, ErrReadOnly)
+	}
+	if _, err := r1.Append("toto"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("r1.Append error = %v, expected %v", err, ErrReadOnly)
+	}
+	r1.Close()
+	r2.Close()
+
+	fm, err = NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("NewFileMgr after readers closed error = %v", err)
+	}
+	fm.Close()
+}
@@ -0,0 +1,103 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OSStorage stores files in a directory of the operating system's file system.
+type OSStorage struct {
+	dir      string
+	isNew    bool
+	lock     *os.File // lock file handle, held while locked
+	readOnly bool
+}
+
+// NewOSStorage opens the directory dir as a Storage, creating it if it does not exist.
+func NewOSStorage(dir string) (*OSStorage, error) {
+	s := &OSStorage{dir: dir}
+
+	// Check if the directory exists
+	_, err := os.Stat(dir)
+	s.isNew = err != nil
+
+	// Create the directory if the database is new
+	if s.isNew {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, fmt.Errorf("creating database directory '%v': %w", dir, err)
+		}
+	}
+	return s, nil
+}
+
+// NewReadOnlyOSStorage opens the existing directory dir as a Storage whose files are opened read-only.
+func NewReadOnlyOSStorage(dir string) (*OSStorage, error) {
+	if !dirExists(dir) {
+		return nil, fmt.Errorf("database directory '%v' does not exist", dir)
+	}
+	return &OSStorage{dir: dir, readOnly: true}, nil
+}
+
+// Dir returns the directory the storage lives in.
+func (s *OSStorage) Dir() string {
+	return s.dir
+}
+
+func (s *OSStorage) Open(filename string) (StorageFile, error) {
+	filePath := filepath.Join(s.dir, filename)
+	flag := os.O_RDWR | os.O_CREATE
+	if s.readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(filePath, flag, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("opening file '%v': %w", filePath, err)
+	}
+	return osFile{f}, nil
+}
+
+func (s *OSStorage) Remove(filename string) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return os.Remove(filepath.Join(s.dir, filename))
+}
+
+func (s *OSStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory '%v': %w", s.dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() != lockFile {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *OSStorage) IsNew() bool {
+	return s.isNew
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Length() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
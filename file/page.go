@@ -2,11 +2,19 @@ package file
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
 )
 
 var Encoding = binary.BigEndian
 
+// ErrOutOfBounds is returned by Page accessors when a value would extend past the page.
+var ErrOutOfBounds = errors.New("page access out of bounds")
+
 // Page represents a fixed-size block of data.
+// Every accessor checks its offset, and any length prefix it reads, against the page size,
+// so corrupt data results in an error rather than a panic.
 type Page struct {
 	bb []byte
 }
@@ -25,38 +33,127 @@ func NewPageFromBytes(b []byte) *Page {
 	}
 }
 
-// GetInt reads an integer from the specified offset.
-func (p *Page) GetInt(offset int) int {
-	return int(Encoding.Uint32(p.bb[offset:]))
+// slice returns the n bytes at the specified offset.
+func (p *Page) slice(offset int, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset > len(p.bb)-n {
+		return nil, fmt.Errorf("%w: %d bytes at offset %d of a %d-byte page", ErrOutOfBounds, n, offset, len(p.bb))
+	}
+	return p.bb[offset : offset+n], nil
+}
+
+// GetInt reads a 32-bit integer from the specified offset.
+func (p *Page) GetInt(offset int) (int, error) {
+	b, err := p.slice(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	return int(int32(Encoding.Uint32(b))), nil
+}
+
+// SetInt writes a 32-bit integer to the specified offset.
+func (p *Page) SetInt(offset int, n int) error {
+	b, err := p.slice(offset, 4)
+	if err != nil {
+		return err
+	}
+	Encoding.PutUint32(b, uint32(n))
+	return nil
+}
+
+// GetInt64 reads a 64-bit integer from the specified offset.
+func (p *Page) GetInt64(offset int) (int64, error) {
+	b, err := p.slice(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(Encoding.Uint64(b)), nil
+}
+
+// SetInt64 writes a 64-bit integer to the specified offset.
+func (p *Page) SetInt64(offset int, n int64) error {
+	b, err := p.slice(offset, 8)
+	if err != nil {
+		return err
+	}
+	Encoding.PutUint64(b, uint64(n))
+	return nil
+}
+
+// GetFloat64 reads a 64-bit float from the specified offset.
+func (p *Page) GetFloat64(offset int) (float64, error) {
+	n, err := p.GetInt64(offset)
+	return math.Float64frombits(uint64(n)), err
+}
+
+// SetFloat64 writes a 64-bit float to the specified offset.
+func (p *Page) SetFloat64(offset int, f float64) error {
+	return p.SetInt64(offset, int64(math.Float64bits(f)))
+}
+
+// GetBool reads a boolean stored as a single byte from the specified offset.
+func (p *Page) GetBool(offset int) (bool, error) {
+	b, err := p.slice(offset, 1)
+	if err != nil {
+		return false, err
+	}
+	return b[0] != 0, nil
 }
 
-// SetInt writes an integer to the specified offset.
-func (p *Page) SetInt(offset int, n int) {
-	Encoding.PutUint32(p.bb[offset:], uint32(n))
+// SetBool writes a boolean as a single byte to the specified offset.
+func (p *Page) SetBool(offset int, v bool) error {
+	b, err := p.slice(offset, 1)
+	if err != nil {
+		return err
+	}
+	b[0] = 0
+	if v {
+		b[0] = 1
+	}
+	return nil
 }
 
-// GetBytes reads a byte slice from the specified offset.
-func (p *Page) GetBytes(offset int) []byte {
-	length := p.GetInt(offset)
-	return p.bb[offset+4 : offset+4+length]
+// GetFixedBytes reads n bytes, stored without a length prefix, from the specified offset.
+func (p *Page) GetFixedBytes(offset int, n int) ([]byte, error) {
+	return p.slice(offset, n)
 }
 
-// SetBytes writes a byte slice to the specified offset.
-func (p *Page) SetBytes(offset int, b []byte) {
+// SetFixedBytes writes b, without a length prefix, to the specified offset.
+func (p *Page) SetFixedBytes(offset int, b []byte) error {
+	dst, err := p.slice(offset, len(b))
+	if err != nil {
+		return err
+	}
+	copy(dst, b)
+	return nil
+}
+
+// GetBytes reads a length-prefixed byte slice from the specified offset.
+func (p *Page) GetBytes(offset int) ([]byte, error) {
+	length, err := p.GetInt(offset)
+	if err != nil {
+		return nil, err
+	}
+	return p.slice(offset+4, length)
+}
+
+// SetBytes writes a length-prefixed byte slice to the specified offset.
+func (p *Page) SetBytes(offset int, b []byte) error {
+	if _, err := p.slice(offset, MaxLength(len(b))); err != nil {
+		return err
+	}
 	p.SetInt(offset, len(b))
-	copy(p.bb[offset+4:], b)
+	return p.SetFixedBytes(offset+4, b)
 }
 
-// GetString reads a string from the specified offset.
-func (p *Page) GetString(offset int) string {
-	length := p.GetInt(offset)
-	return string(p.bb[offset+4 : offset+4+length])
+// GetString reads a length-prefixed string from the specified offset.
+func (p *Page) GetString(offset int) (string, error) {
+	b, err := p.GetBytes(offset)
+	return string(b), err
 }
 
-// SetString writes a string to the specified offset.
-func (p *Page) SetString(offset int, s string) {
-	p.SetInt(offset, len(s))
-	copy(p.bb[offset+4:], s)
+// SetString writes a length-prefixed string to the specified offset.
+func (p *Page) SetString(offset int, s string) error {
+	return p.SetBytes(offset, []byte(s))
 }
 
 // MaxLength calculates the maximum number of bytes required to store a string of the given length.
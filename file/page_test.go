@@ -2,6 +2,8 @@ package file
 
 import (
 	"bytes"
+	"errors"
+	"math"
 	"testing"
 )
 
@@ -11,26 +13,75 @@ func TestPage(t *testing.T) {
 	expectedInt := 15
 	offsetInt := 5
 	p.SetInt(offsetInt, expectedInt)
-	actualInt := p.GetInt(offsetInt)
-	if actualInt != expectedInt {
-		t.Errorf("GetInt(%d) returned %d, expected %d", offsetInt, actualInt, expectedInt)
+	actualInt, err := p.GetInt(offsetInt)
+	if err != nil || actualInt != expectedInt {
+		t.Errorf("GetInt(%d) returned %d, %v, expected %d", offsetInt, actualInt, err, expectedInt)
 	}
 
 	// Test SetBytes and GetBytes
 	expectedBytes := []byte{101, 102}
 	offsetBytes := 20
 	p.SetBytes(offsetBytes, expectedBytes)
-	actualBytes := p.GetBytes(offsetBytes)
-	if !bytes.Equal(actualBytes, expectedBytes) {
-		t.Errorf("GetBytes(%d) returned %v, expected %v", offsetBytes, actualBytes, expectedBytes)
+	actualBytes, err := p.GetBytes(offsetBytes)
+	if err != nil || !bytes.Equal(actualBytes, expectedBytes) {
+		t.Errorf("GetBytes(%d) returned %v, %v, expected %v", offsetBytes, actualBytes, err, expectedBytes)
 	}
 
 	// Test SetString and GetString
 	expectedString := "test"
 	offsetString := 100
 	p.SetString(offsetString, expectedString)
-	actualString := p.GetString(offsetString)
-	if actualString != expectedString {
-		t.Errorf("GetString(%d) returned %q, expected %q", offsetString, actualString, expectedString)
+	actualString, err := p.GetString(offsetString)
+	if err != nil || actualString != expectedString {
+		t.Errorf("GetString(%d) returned %q, %v, expected %q", offsetString, actualString, err, expectedString)
+	}
+
+	// Test the fixed-width accessors
+	p.SetInt64(200, math.MinInt64)
+	if v, err := p.GetInt64(200); err != nil || v != math.MinInt64 {
+		t.Errorf("GetInt64(200) returned %d, %v, expected %d", v, err, int64(math.MinInt64))
+	}
+	p.SetFloat64(208, 3.25)
+	if v, err := p.GetFloat64(208); err != nil || v != 3.25 {
+		t.Errorf("GetFloat64(208) returned %v, %v, expected 3.25", v, err)
+	}
+	p.SetBool(216, true)
+	if v, err := p.GetBool(216); err != nil || !v {
+		t.Errorf("GetBool(216) returned %v, %v, expected true", v, err)
+	}
+	p.SetFixedBytes(217, []byte("abc"))
+	if v, err := p.GetFixedBytes(217, 3); err != nil || string(v) != "abc" {
+		t.Errorf("GetFixedBytes(217, 3) returned %q, %v, expected %q", v, err, "abc")
+	}
+	p.SetInt(300, -1)
+	if v, _ := p.GetInt(300); v != -1 {
+		t.Errorf("GetInt(300) returned %d, expected -1", v)
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	p := NewPage(64)
+	checks := map[string]error{
+		"GetInt past the end":    func() error { _, err := p.GetInt(61); return err }(),
+		"GetInt negative offset": func() error { _, err := p.GetInt(-4); return err }(),
+		"SetInt64 past the end":  p.SetInt64(60, 1),
+		"SetBool past the end":   p.SetBool(64, true),
+		"SetString too long":     p.SetString(50, "more than ten bytes"),
+		"GetFixedBytes too long": func() error { _, err := p.GetFixedBytes(0, 65); return err }(),
+	}
+	for name, err := range checks {
+		if !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("%s: error = %v, expected %v", name, err, ErrOutOfBounds)
+		}
+	}
+
+	// corrupt length prefixes
+	p.SetInt(0, 1000)
+	if _, err := p.GetString(0); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("GetString with a corrupt length: error = %v, expected %v", err, ErrOutOfBounds)
+	}
+	p.SetInt(0, -8)
+	if _, err := p.GetBytes(0); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("GetBytes with a negative length: error = %v, expected %v", err, ErrOutOfBounds)
 	}
 }
@@ -0,0 +1,53 @@
+package file
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FileStats counts the block I/O done on a file through the FileMgr.
+type FileStats struct {
+	BlockReads  int64
+	BlockWrites int64 // including appended blocks
+}
+
+// fileStats holds the I/O counters of every file.
+// Reads and writes of different files don't contend on the counters.
+type fileStats struct {
+	files sync.Map // filename -> *fileCounters
+}
+
+type fileCounters struct {
+	reads  atomic.Int64
+	writes atomic.Int64
+}
+
+func (s *fileStats) count(filename string, reads, writes int64) {
+	c, ok := s.files.Load(filename)
+	if !ok {
+		c, _ = s.files.LoadOrStore(filename, &fileCounters{})
+	}
+	counters := c.(*fileCounters)
+	counters.reads.Add(reads)
+	counters.writes.Add(writes)
+}
+
+// Stats returns a snapshot of the I/O counters of the files read or written
+// since the FileMgr was created or its counters were reset.
+func (fm *FileMgr) Stats() map[string]FileStats {
+	snapshot := make(map[string]FileStats)
+	fm.stats.files.Range(func(filename, c any) bool {
+		counters := c.(*fileCounters)
+		snapshot[filename.(string)] = FileStats{
+			BlockReads:  counters.reads.Load(),
+			BlockWrites: counters.writes.Load(),
+		}
+		return true
+	})
+	return snapshot
+}
+
+// ResetStats resets the I/O counters of every file.
+func (fm *FileMgr) ResetStats() {
+	fm.stats.files.Clear()
+}
@@ -0,0 +1,79 @@
+package file
+
+import (
+	"fmt"
+	"io"
+)
+
+// Storage is the medium a FileMgr keeps its files on.
+// Filenames are relative to the storage root.
+type Storage interface {
+	// Open opens the named file for reading and writing, creating it if needed.
+	Open(filename string) (StorageFile, error)
+	// Remove deletes the named file.
+	Remove(filename string) error
+	// List returns the names of all files in the storage.
+	List() ([]string, error)
+	// IsNew reports whether the storage did not exist before it was opened.
+	IsNew() bool
+}
+
+// StorageFile is an open file of a Storage, accessed by position.
+type StorageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	// Sync commits the file's contents to stable storage.
+	Sync() error
+	// Length returns the size of the file in bytes.
+	Length() (int64, error)
+	// Truncate changes the size of the file.
+	Truncate(size int64) error
+	Close() error
+}
+
+// CopyStorageFile copies the raw contents of filename from src to dst,
+// which must not already hold a file of that name, and syncs the copy.
+func CopyStorageFile(src Storage, dst Storage, filename string) error {
+	f, err := src.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Length()
+	if err != nil {
+		return fmt.Errorf("getting length of file '%v': %w", filename, err)
+	}
+	return copyStorageFile(f, size, dst, filename)
+}
+
+// copyStorageFile copies the first size bytes of f to a new file of dst named filename, and syncs it.
+func copyStorageFile(f StorageFile, size int64, dst Storage, filename string) error {
+	out, err := dst.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	existing, err := out.Length()
+	if err != nil {
+		return fmt.Errorf("getting length of file '%v': %w", filename, err)
+	}
+	if existing != 0 {
+		return fmt.Errorf("copying file '%v': destination file already exists", filename)
+	}
+
+	buf := make([]byte, 64*1024)
+	for offset := int64(0); offset < size; {
+		n := min(int64(len(buf)), size-offset)
+		if _, err := f.ReadAt(buf[:n], offset); err != nil {
+			return fmt.Errorf("reading file '%v' at offset %d: %w", filename, offset, err)
+		}
+		if _, err := out.WriteAt(buf[:n], offset); err != nil {
+			return fmt.Errorf("writing copy of file '%v' at offset %d: %w", filename, offset, err)
+		}
+		offset += n
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("syncing copy of file '%v': %w", filename, err)
+	}
+	return nil
+}
@@ -5,12 +5,10 @@ go 1.24.0
 require (
 	github.com/bzick/tokenizer v1.4.10
 	github.com/stretchr/testify v1.10.0
-	github.com/viney-shih/go-lock v1.1.2
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sync v0.0.0-20200317015054-43a5402ce75a // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
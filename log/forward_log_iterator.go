@@ -0,0 +1,138 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// ForwardLogIterator reads log records in the order they were appended.
+// Once it has returned every flushed record, NextRecord returns nil,
+// but later calls return the records flushed in the meantime,
+// so that the iterator can be used to follow the log.
+type ForwardLogIterator struct {
+	lm          *LogMgr
+	currentBlk  *file.BlockId
+	currentPage *file.Page
+	positions   []int // offsets of the unread records of the current block, in LSN order
+	currentLSN  int
+}
+
+// ForwardIterator returns an iterator positioned before the first record whose LSN is at least lsn.
+// The log is flushed first, so every record appended so far can be read.
+func (lm *LogMgr) ForwardIterator(lsn int) (*ForwardLogIterator, error) {
+	if err := lm.Flush(lm.LatestLSN()); err != nil {
+		return nil, err
+	}
+	li := &ForwardLogIterator{
+		lm:          lm,
+		currentPage: file.NewPage(lm.fm.BlockSize()),
+	}
+	if err := li.Seek(lsn); err != nil {
+		return nil, err
+	}
+	return li, nil
+}
+
+// Seek positions the iterator before the first record whose LSN is at least lsn.
+// Returns an error wrapping ErrSegmentReleased if that record's segment was released.
+func (li *ForwardLogIterator) Seek(lsn int) error {
+	blockSize := li.lm.fm.BlockSize()
+	blknum := 0
+	if lsn > 0 {
+		blknum = (lsn - 1) / blockSize
+	}
+	li.currentLSN = lsn - 1
+	// past the end of the log: wait for the records to come
+	blknum = min(blknum, li.lm.lastBlock())
+	return li.readBlock(blknum)
+}
+
+// NextRecord returns the next log record, or nil if every flushed record has been read.
+// Returns an error if a log block could not be read.
+func (li *ForwardLogIterator) NextRecord() ([]byte, error) {
+	if len(li.positions) == 0 {
+		// look for records flushed to the current block since it was read
+		if err := li.readBlock(li.currentBlk.Blknum); err != nil {
+			return nil, err
+		}
+	}
+	for len(li.positions) == 0 {
+		if li.currentBlk.Blknum >= li.lm.lastBlock() {
+			return nil, nil
+		}
+		if err := li.readBlock(li.currentBlk.Blknum + 1); err != nil {
+			return nil, err
+		}
+	}
+
+	pos := li.positions[0]
+	li.positions = li.positions[1:]
+	lsn, b, err := readRecord(li.currentPage, pos)
+	if err != nil {
+		return nil, fmt.Errorf("reading log record at offset %d of block %v: %w", pos, li.currentBlk, err)
+	}
+	li.currentLSN = lsn
+	return b, nil
+}
+
+// LSN returns the LSN of the record last returned by NextRecord.
+func (li *ForwardLogIterator) LSN() int {
+	return li.currentLSN
+}
+
+// readBlock reads the log block blknum and the positions of its records
+// with an LSN greater than the current one.
+// The log manager is locked so that the block isn't read while it is being flushed.
+func (li *ForwardLogIterator) readBlock(blknum int) error {
+	lm := li.lm
+	blk := file.NewBlockId(lm.logfile, blknum)
+	lm.Lock()
+	err := lm.readBlock(blknum, li.currentPage)
+	lm.Unlock()
+	if err != nil {
+		return err
+	}
+	positions, err := recordPositions(li.currentPage)
+	if err != nil {
+		return fmt.Errorf("reading log block %v: %w", blk, err)
+	}
+
+	li.currentBlk = blk
+	li.positions = li.positions[:0]
+	// records are stored right to left, so the last position holds the oldest record
+	for i := len(positions) - 1; i >= 0; i-- {
+		if lsnAt(lm.fm.BlockSize(), blknum, positions[i]) > li.currentLSN {
+			li.positions = append(li.positions, positions[i])
+		}
+	}
+	return nil
+}
+
+// recordPositions returns the offsets of the records of a log page, most recent first.
+func recordPositions(p *file.Page) ([]int, error) {
+	blockSize := len(p.Contents())
+	pos, err := p.GetInt(0)
+	if err != nil {
+		return nil, err
+	}
+	if pos < INTEGER_BYTES {
+		return nil, fmt.Errorf("invalid boundary %d", pos)
+	}
+	var positions []int
+	for pos < blockSize {
+		length, err := p.GetInt(pos)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("invalid record length %d at offset %d", length, pos)
+		}
+		positions = append(positions, pos)
+		pos += INTEGER_BYTES + length
+	}
+	if pos != blockSize {
+		return nil, fmt.Errorf("records overrun the end of the block")
+	}
+	return positions, nil
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// WithGroupCommit makes a Flush wait up to window for other Flush calls to join it,
+// so that their records are made durable by a single write and sync of the log.
+// The wait ends early once maxBatch calls are waiting; maxBatch <= 0 means no limit.
+// Without it, Flush calls still share a sync when they happen to overlap.
+func WithGroupCommit(window time.Duration, maxBatch int) Option {
+	return func(lm *LogMgr) {
+		lm.group.window = window
+		lm.group.maxBatch = maxBatch
+	}
+}
+
+// groupCommit holds the state of the Flush calls waiting for a sync of the log.
+// It is guarded by the LogMgr lock.
+type groupCommit struct {
+	window   time.Duration
+	maxBatch int
+	flushed  *sync.Cond    // broadcast after every flush of the log
+	leading  bool          // a Flush is waiting for its batch or flushing it
+	pending  int           // Flush calls waiting for the next flush, including the leading one
+	full     chan struct{} // closed when pending reaches maxBatch
+	syncs    int64         // flushes done on behalf of Flush calls
+	commits  int64         // Flush calls served by those flushes
+}
+
+// GroupCommitStats reports how Flush calls were batched.
+type GroupCommitStats struct {
+	Syncs   int64 // log flushes done by Flush
+	Commits int64 // Flush calls that needed a flush
+}
+
+// CommitsPerSync returns the average number of Flush calls served by a single flush of the log.
+func (s GroupCommitStats) CommitsPerSync() float64 {
+	if s.Syncs == 0 {
+		return 0
+	}
+	return float64(s.Commits) / float64(s.Syncs)
+}
+
+// GroupCommitStats returns the batching statistics of Flush.
+func (lm *LogMgr) GroupCommitStats() GroupCommitStats {
+	lm.Lock()
+	defer lm.Unlock()
+	return GroupCommitStats{Syncs: lm.group.syncs, Commits: lm.group.commits}
+}
+
+// Flush ensures that the log record corresponding to the specified LSN has been written to disk.
+// All earlier log records will also be written to disk.
+// Callers whose records were made durable by an earlier flush return without any I/O.
+// Concurrent callers are batched: the first one waits for the group commit window,
+// then flushes the log for all of them while the others wait.
+func (lm *LogMgr) Flush(lsn int) error {
+	lm.Lock()
+	defer lm.Unlock()
+	g := &lm.group
+	if lsn > lm.lastSavedLSN {
+		g.pending++
+		if g.maxBatch > 0 && g.pending >= g.maxBatch && g.full != nil {
+			close(g.full)
+			g.full = nil
+		}
+	}
+	for lsn > lm.lastSavedLSN {
+		if g.leading {
+			g.flushed.Wait()
+			continue
+		}
+
+		g.leading = true
+		if g.window > 0 && (g.maxBatch <= 0 || g.pending < g.maxBatch) {
+			full := make(chan struct{})
+			g.full = full
+			lm.Unlock()
+			timer := time.NewTimer(g.window)
+			select {
+			case <-timer.C:
+			case <-full:
+				timer.Stop()
+			}
+			lm.Lock()
+			g.full = nil
+		}
+		// the batch may have been flushed in the meantime, e.g. by Append
+		var err error
+		if lsn > lm.lastSavedLSN {
+			err = lm.flush()
+		}
+		g.leading = false
+		// let a waiting caller lead the next batch, or retry after an error
+		g.flushed.Broadcast()
+		if err != nil {
+			g.pending--
+			return err
+		}
+	}
+	return nil
+}
+
+// flushedAll records that every pending Flush call was served by a flush of the log, and wakes them up.
+func (g *groupCommit) flushedAll() {
+	if g.pending > 0 {
+		g.syncs++
+		g.commits += int64(g.pending)
+		g.pending = 0
+	}
+	g.flushed.Broadcast()
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// commitConcurrently has n goroutines append and flush a record commits times each.
+func commitConcurrently(lm *LogMgr, n int, commits int) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < commits; j++ {
+				lsn, err := lm.Append([]byte("commit"))
+				if err == nil {
+					err = lm.Flush(lsn)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func TestGroupCommit(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logGroupCommit")
+	os.RemoveAll(tempDir) // clean up any previous runs
+
+	fm, err := file.NewFileMgr(tempDir, 400)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err := NewLogMgr(fm, "testlog", WithGroupCommit(5*time.Millisecond, 4))
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	if err := commitConcurrently(logMgr, 8, 10); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	stats := logMgr.GroupCommitStats()
+	if stats.Commits == 0 || stats.Commits > 80 {
+		t.Errorf("Expected between 1 and 80 commits needing a sync, got %d", stats.Commits)
+	}
+	if stats.CommitsPerSync() <= 1 {
+		t.Errorf("Expected commits to share syncs, got %v commits per sync", stats.CommitsPerSync())
+	}
+
+	iter, _ := logMgr.Iterator()
+	count := 0
+	for record, err := iter.NextRecord(); record != nil || err != nil; record, err = iter.NextRecord() {
+		if err != nil {
+			t.Fatalf("Failed to read record: %v", err)
+		}
+		count++
+	}
+	if count != 80 {
+		t.Errorf("Expected 80 records, got %d", count)
+	}
+}
+
+// BenchmarkGroupCommit measures concurrent commits with and without a group commit window.
+func BenchmarkGroupCommit(b *testing.B) {
+	for _, window := range []time.Duration{0, 200 * time.Microsecond} {
+		b.Run(fmt.Sprintf("window-%v", window), func(b *testing.B) {
+			tempDir := filepath.Join(os.TempDir(), "logGroupCommitBenchmark")
+			os.RemoveAll(tempDir)
+			fm, err := file.NewFileMgr(tempDir, 4096)
+			if err != nil {
+				b.Fatalf("NewFileMgr error = %v", err)
+			}
+			defer fm.Close()
+			logMgr, err := NewLogMgr(fm, "benchlog", WithGroupCommit(window, 16))
+			if err != nil {
+				b.Fatalf("NewLogMgr error = %v", err)
+			}
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					lsn, _ := logMgr.Append([]byte("commit"))
+					if err := logMgr.Flush(lsn); err != nil {
+						b.Errorf("Flush error = %v", err)
+					}
+				}
+			})
+			b.ReportMetric(logMgr.GroupCommitStats().CommitsPerSync(), "commits/sync")
+		})
+	}
+}
@@ -7,31 +7,64 @@ import (
 	"github.com/CefBoud/CefDB/file"
 )
 
-// LogMgr manages the log file.
+// LogMgr manages the log.
+//
+// The log is split into segment files of a fixed number of blocks, named after the log file.
+// Blocks are numbered across segments, so that block n of the log is block
+// n % segmentBlocks of segment n / segmentBlocks.
+// The LSN of a log record is its position in the log: the number of log bytes
+// before its block, plus its distance from the end of the block, where records start.
+// LSNs therefore increase with every appended record, survive restarts,
+// and are stored with each record so that they can be read back.
 type LogMgr struct {
-	fm           *file.FileMgr
-	logfile      string
-	logpage      *file.Page
-	currentblk   *file.BlockId
-	latestLSN    int
-	lastSavedLSN int
+	fm            *file.FileMgr
+	logfile       string
+	segmentBlocks int
+	retention     RetentionPolicy
+	firstBlk      int // first block that wasn't released by the retention policy
+	logpage       *file.Page
+	currentblk    *file.BlockId
+	latestLSN     int
+	lastSavedLSN  int
+	truncatedLSN  int  // where a torn log tail was cut off when opening the log, or -1
+	tailRepaired  bool // the last block was torn when opening the log
+	group         groupCommit
 	sync.Mutex
 }
 
 const INTEGER_BYTES = 4
 
-// NewLogMgr creates a new LogMgr for the specified log file.
-// If the log file does not yet exist, it is created with an empty first block.
-func NewLogMgr(fm *file.FileMgr, logfile string) (*LogMgr, error) {
+// LSN_BYTES is the size of the LSN stored in front of every log record.
+const LSN_BYTES = 8
+
+// NewLogMgr creates a new LogMgr for the log named logfile.
+// If the log does not yet exist, its first segment is created with an empty first block.
+func NewLogMgr(fm *file.FileMgr, logfile string, opts ...Option) (*LogMgr, error) {
 	lm := &LogMgr{
-		fm:      fm,
-		logfile: logfile,
-		logpage: file.NewPage(fm.BlockSize()),
+		fm:            fm,
+		logfile:       logfile,
+		segmentBlocks: DEFAULT_SEGMENT_BLOCKS,
+		logpage:       file.NewPage(fm.BlockSize()),
+		truncatedLSN:  -1,
+	}
+	lm.group.flushed = sync.NewCond(&lm.Mutex)
+	for _, opt := range opts {
+		opt(lm)
+	}
+	segments, err := lm.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		segments = []int{0}
 	}
-	logsize, err := fm.Length(logfile)
+	lastSegment := segments[len(segments)-1]
+	lm.firstBlk = segments[0] * lm.segmentBlocks
+	logsize, err := fm.Length(SegmentName(logfile, lastSegment))
 	if err != nil {
-		return nil, fmt.Errorf("getting log file length: %w", err)
+		return nil, fmt.Errorf("getting log segment length: %w", err)
 	}
+	lm.currentblk = file.NewBlockId(logfile, lastSegment*lm.segmentBlocks+logsize-1)
 
 	if logsize == 0 {
 		blk, err := lm.appendNewBlock()
@@ -39,37 +72,72 @@ func NewLogMgr(fm *file.FileMgr, logfile string) (*LogMgr, error) {
 			return nil, fmt.Errorf("appending new block: %w", err)
 		}
 		lm.currentblk = blk
+		lm.latestLSN = lm.lsnAt(blk.Blknum, fm.BlockSize())
 	} else {
-		lm.currentblk = file.NewBlockId(logfile, logsize-1)
-		if err := fm.Read(lm.currentblk, lm.logpage); err != nil {
+		err := lm.readBlock(lm.currentblk.Blknum, lm.logpage)
+		if lm.truncatedLSN, err = lm.repairTail(err); err != nil {
 			return nil, fmt.Errorf("reading log page: %w", err)
 		}
+		if lm.truncatedLSN >= 0 {
+			fmt.Printf("warning: log '%v' had a torn tail, truncated at LSN %d\n", logfile, lm.truncatedLSN)
+		}
+		boundary, err := lm.logpage.GetInt(0)
+		if err != nil {
+			return nil, fmt.Errorf("reading log page boundary: %w", err)
+		}
+		// everything up to the boundary of the last block is on disk
+		lm.latestLSN = lm.lsnAt(lm.currentblk.Blknum, boundary)
 	}
+	lm.lastSavedLSN = lm.latestLSN
 	return lm, nil
 }
 
-// Flush ensures that the log record corresponding to the specified LSN has been written to disk.
-// All earlier log records will also be written to disk.
-func (lm *LogMgr) Flush(lsn int) error {
-	if lsn >= lm.lastSavedLSN {
-		return lm.flush()
+// TruncatedLSN returns the LSN the log was truncated at, because its tail was torn
+// by a crash, when the LogMgr was created. Records with a greater LSN were lost.
+// Returns false if the log was intact.
+func (lm *LogMgr) TruncatedLSN() (int, bool) {
+	return lm.truncatedLSN, lm.truncatedLSN >= 0
+}
+
+// CopyTo flushes the log and copies the log segments that weren't released to dst.
+// Records are not appended while the copy is in progress,
+// so the copy holds every record appended before CopyTo was called.
+func (lm *LogMgr) CopyTo(dst file.Storage) error {
+	lm.Lock()
+	defer lm.Unlock()
+	if err := lm.flushAppended(); err != nil {
+		return err
+	}
+	segments, err := lm.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s < lm.firstBlk/lm.segmentBlocks {
+			continue // being released
+		}
+		if err := lm.fm.CopyFile(SegmentName(lm.logfile, s), dst); err != nil {
+			return fmt.Errorf("copying log segment %d: %w", s, err)
+		}
 	}
 	return nil
 }
 
 // Iterator returns an iterator for the log records in reverse order.
+// The iterator only returns the records appended before it was created.
 func (lm *LogMgr) Iterator() (*LogIterator, error) {
-	if err := lm.flush(); err != nil {
+	lm.Lock()
+	defer lm.Unlock()
+	if err := lm.flushAppended(); err != nil {
 		return nil, err
 	}
-	return NewLogIterator(lm.fm, lm.currentblk), nil
-	// return iter.Iterate(), nil
+	return newLogIterator(lm, lm.currentblk.Blknum)
 }
 
 // Append appends a log record to the log buffer.
 // The record consists of an arbitrary array of bytes.
 // Log records are written right to left in the buffer.
-// The size of the record is written before the bytes.
+// The size of the record, a checksum and the LSN are written before the bytes.
 // The beginning of the buffer contains the location
 // of the last-written record (the "boundary").
 // Storing the records backwards makes it easy to read
@@ -79,9 +147,12 @@ func (lm *LogMgr) Append(logrec []byte) (int, error) {
 	lm.Lock()
 	defer lm.Unlock()
 
-	boundary := int(lm.logpage.GetInt(0))
+	boundary, err := lm.logpage.GetInt(0)
+	if err != nil {
+		return -1, fmt.Errorf("reading log page boundary: %w", err)
+	}
 	recsize := len(logrec)
-	bytesneeded := recsize + INTEGER_BYTES // Size of int32 for record length
+	bytesneeded := recsize + FRAME_BYTES
 
 	if boundary-bytesneeded < INTEGER_BYTES { // the log record doesn't fit,
 		if err := lm.flush(); err != nil { // so move to the next block.
@@ -92,80 +163,168 @@ func (lm *LogMgr) Append(logrec []byte) (int, error) {
 			return -1, err
 		}
 		lm.currentblk = blk
-		boundary = lm.logpage.GetInt(0)
+		boundary = lm.fm.BlockSize()
 	}
 	recpos := boundary - bytesneeded
+	lsn := lm.lsnAt(lm.currentblk.Blknum, recpos)
 
-	lm.logpage.SetBytes(recpos, logrec)
+	if err := writeRecord(lm.logpage, recpos, lsn, logrec); err != nil {
+		return -1, fmt.Errorf("writing %d-byte log record: %w", recsize, err)
+	}
 	lm.logpage.SetInt(0, recpos)
 
-	lm.latestLSN++
+	lm.latestLSN = lsn
 	return lm.latestLSN, nil
 }
 
-// appendNewBlock initializes a new block for the log file and appends it.
+// lsnAt returns the LSN of the record at offset recpos of log block blknum.
+func (lm *LogMgr) lsnAt(blknum int, recpos int) int {
+	return lsnAt(lm.fm.BlockSize(), blknum, recpos)
+}
+
+func lsnAt(blockSize int, blknum int, recpos int) int {
+	return blknum*blockSize + blockSize - recpos
+}
+
+// LatestLSN returns the LSN of the most recently appended record.
+func (lm *LogMgr) LatestLSN() int {
+	lm.Lock()
+	defer lm.Unlock()
+	return lm.latestLSN
+}
+
+// FlushedLSN returns the LSN of the most recent record written to disk.
+func (lm *LogMgr) FlushedLSN() int {
+	lm.Lock()
+	defer lm.Unlock()
+	return lm.lastSavedLSN
+}
+
+// appendNewBlock initializes the block following the current one and appends it,
+// starting a new segment file when the current one is full.
 func (lm *LogMgr) appendNewBlock() (*file.BlockId, error) {
-	blk, err := lm.fm.Append(lm.logfile)
+	blk := file.NewBlockId(lm.logfile, lm.currentblk.Blknum+1)
+	segblk := lm.segmentBlock(blk.Blknum)
+	appended, err := lm.fm.Append(segblk.Filename)
 	if err != nil {
 		return nil, fmt.Errorf("appending block to file manager: %w", err)
 	}
+	if appended.Blknum != segblk.Blknum {
+		return nil, fmt.Errorf("appended block %v to log segment, expected %v", appended, segblk)
+	}
 
 	lm.logpage.SetInt(0, lm.fm.BlockSize())
-	if err := lm.fm.Write(blk, lm.logpage); err != nil {
+	if err := lm.fm.Write(segblk, lm.logpage); err != nil {
 		return nil, fmt.Errorf("writing new block to file manager: %w", err)
 	}
+	if err := lm.fm.Sync(segblk.Filename); err != nil {
+		return nil, fmt.Errorf("syncing new block: %w", err)
+	}
 	return blk, nil
 }
 
-// flush writes the current log buffer to the log file.
+// lastBlock returns the number of the block records are currently appended to.
+func (lm *LogMgr) lastBlock() int {
+	lm.Lock()
+	defer lm.Unlock()
+	return lm.currentblk.Blknum
+}
+
+// flush writes the current log buffer to the tail copy, then to its segment file, and syncs them.
 func (lm *LogMgr) flush() error {
-	if err := lm.fm.Write(lm.currentblk, lm.logpage); err != nil {
+	if err := lm.writeTailCopy(); err != nil {
+		return fmt.Errorf("writing log tail copy: %w", err)
+	}
+	segblk := lm.segmentBlock(lm.currentblk.Blknum)
+	if err := lm.fm.Write(segblk, lm.logpage); err != nil {
 		return fmt.Errorf("writing log page to file manager: %w", err)
 	}
+	if err := lm.fm.Sync(segblk.Filename); err != nil {
+		return fmt.Errorf("syncing log file: %w", err)
+	}
 	lm.lastSavedLSN = lm.latestLSN
+	lm.group.flushedAll()
 	return nil
 }
 
+// flushAppended flushes the log buffer if records were appended since the last flush.
+// A read-only log, which can't be written, is never flushed.
+func (lm *LogMgr) flushAppended() error {
+	if lm.latestLSN == lm.lastSavedLSN {
+		return nil
+	}
+	return lm.flush()
+}
+
 // LogIterator provides an iterator to read log records in reverse order.
 type LogIterator struct {
-	fm          *file.FileMgr
+	lm          *LogMgr
 	currentBlk  *file.BlockId
 	currentPage *file.Page
 	currentPos  int
+	currentLSN  int
+	firstBlk    int
 	blockSize   int
 }
 
-// NewLogIterator creates a new LogIterator.
-func NewLogIterator(fm *file.FileMgr, currentBlk *file.BlockId) *LogIterator {
-	blockSize := fm.BlockSize()
+// newLogIterator creates a new LogIterator positioned after the last record of log block blknum.
+// The log manager must be locked.
+func newLogIterator(lm *LogMgr, blknum int) (*LogIterator, error) {
+	blockSize := lm.fm.BlockSize()
 	p := file.NewPage(blockSize)
-	fm.Read(currentBlk, p)
-	boundary := p.GetInt(0)
+	if err := lm.readBlock(blknum, p); err != nil {
+		return nil, err
+	}
+	currentBlk := file.NewBlockId(lm.logfile, blknum)
+	boundary, err := p.GetInt(0)
+	if err != nil {
+		return nil, fmt.Errorf("reading log block %v: %w", currentBlk, err)
+	}
 	return &LogIterator{
-		fm:          fm,
+		lm:          lm,
 		currentBlk:  currentBlk,
 		currentPage: p,
 		currentPos:  boundary,
+		firstBlk:    lm.firstBlk,
 		blockSize:   blockSize,
-	}
+	}, nil
 }
 
-// nextRecord reads the next log record (going backwards).
-// Returns nil if there are no more records in the current block.
-func (li *LogIterator) NextRecord() []byte {
-	if li.currentPos < li.fm.BlockSize() {
-		return li.readCurrentRecord()
-	} else if li.currentBlk.Blknum > 0 {
+// NextRecord reads the next log record (going backwards).
+// Returns nil once there are no more records, including in released segments,
+// and an error if a log block could not be read.
+func (li *LogIterator) NextRecord() ([]byte, error) {
+	for li.currentPos >= li.blockSize {
+		if li.currentBlk.Blknum <= li.firstBlk {
+			return nil, nil
+		}
 		li.currentBlk.Blknum -= 1
-		li.fm.Read(li.currentBlk, li.currentPage)
-		li.currentPos = li.currentPage.GetInt(0)
-		return li.readCurrentRecord()
+		li.lm.Lock()
+		err := li.lm.readBlock(li.currentBlk.Blknum, li.currentPage)
+		li.lm.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		boundary, err := li.currentPage.GetInt(0)
+		if err != nil {
+			return nil, fmt.Errorf("reading log block %v: %w", li.currentBlk, err)
+		}
+		li.currentPos = boundary
 	}
-	return nil
+	return li.readCurrentRecord()
+}
+
+func (li *LogIterator) readCurrentRecord() ([]byte, error) {
+	lsn, b, err := readRecord(li.currentPage, li.currentPos)
+	if err != nil {
+		return nil, fmt.Errorf("reading log record at offset %d of block %v: %w", li.currentPos, li.currentBlk, err)
+	}
+	li.currentLSN = lsn
+	li.currentPos += FRAME_BYTES + len(b)
+	return b, nil
 }
 
-func (li *LogIterator) readCurrentRecord() []byte {
-	b := li.currentPage.GetBytes(li.currentPos)
-	li.currentPos += len(b) + 4
-	return b
+// LSN returns the LSN of the record last returned by NextRecord.
+func (li *LogIterator) LSN() int {
+	return li.currentLSN
 }
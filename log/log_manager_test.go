@@ -1,6 +1,8 @@
 package log
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -34,8 +36,9 @@ func TestLogMgr(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to append first record: %v", err)
 	}
-	if lsn1 != 1 { // 1
-		t.Fatalf("Expected LSN1 to be greater 1, got %d", lsn1)
+	// the record, its LSN and its length fill the block from the end
+	if expected := len(logRec1) + FRAME_BYTES; lsn1 != expected {
+		t.Fatalf("Expected LSN1 to be %d, got %d", expected, lsn1)
 	}
 
 	// Append second record
@@ -43,8 +46,9 @@ func TestLogMgr(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to append second record: %v", err)
 	}
-	if lsn2 != 2 {
-		t.Fatalf("Expected LSN2 to be 2, got : %d", lsn2)
+	// the second record doesn't fit in the first block
+	if expected := 128 + len(logRec2) + FRAME_BYTES; lsn2 != expected {
+		t.Fatalf("Expected LSN2 to be %d, got : %d", expected, lsn2)
 	}
 
 	// Flush the logs to ensure they're written to disk
@@ -55,8 +59,8 @@ func TestLogMgr(t *testing.T) {
 
 	logRec3 := []byte("Third log record, Third log record, Third log record, Third log record, Third log record")
 
-	// Append second record
-	_, err = logMgr.Append(logRec3)
+	// Append third record
+	lsn3, err := logMgr.Append(logRec3)
 	if err != nil {
 		t.Fatalf("Failed to append third record: %v", err)
 	}
@@ -67,15 +71,24 @@ func TestLogMgr(t *testing.T) {
 	}
 
 	// Test reading the logs back in reverse order
-	record := iter.NextRecord()
+	record, err := iter.NextRecord()
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
 	if record == nil {
 		t.Fatal("Expected to read a record, but got nil")
 	}
 	if string(record) != string(logRec3) {
 		t.Fatalf("Read record doesn't match expected third record. Got: %s, Expected: %s", string(record), string(logRec3))
 	}
+	if iter.LSN() != lsn3 {
+		t.Fatalf("Expected the third record's LSN to be %d, got %d", lsn3, iter.LSN())
+	}
 
-	record = iter.NextRecord()
+	record, err = iter.NextRecord()
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
 	if record == nil {
 		t.Fatal("Expected to read a record, but got nil")
 	}
@@ -83,17 +96,222 @@ func TestLogMgr(t *testing.T) {
 		t.Fatalf("Read record doesn't match expected second record. Got: %s, Expected: %s", string(record), string(logRec2))
 	}
 
-	record = iter.NextRecord()
+	record, err = iter.NextRecord()
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
 	if record == nil {
 		t.Fatal("Expected to read a record, but got nil")
 	}
 	if string(record) != string(logRec1) {
 		t.Fatalf("Read record doesn't match expected first record. Got: %s, Expected: %s", string(record), string(logRec1))
 	}
+	if iter.LSN() != lsn1 {
+		t.Fatalf("Expected the first record's LSN to be %d, got %d", lsn1, iter.LSN())
+	}
 
 	// Ensure no more records are available
-	record = iter.NextRecord()
+	record, err = iter.NextRecord()
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
 	if record != nil {
 		t.Fatalf("Expected no more records after reading all records, but got: %s", string(record))
 	}
+
+	// LSNs keep increasing after a restart
+	fm.Close()
+	fm, err = file.NewFileMgr(tempDir, 128)
+	if err != nil {
+		t.Fatalf("Failed to reopen FileMgr: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err = NewLogMgr(fm, logfile)
+	if err != nil {
+		t.Fatalf("Failed to reopen LogMgr: %v", err)
+	}
+	if logMgr.LatestLSN() != lsn3 {
+		t.Fatalf("Expected the latest LSN after a restart to be %d, got %d", lsn3, logMgr.LatestLSN())
+	}
+	lsn4, err := logMgr.Append(logRec1)
+	if err != nil {
+		t.Fatalf("Failed to append fourth record: %v", err)
+	}
+	if lsn4 <= lsn3 {
+		t.Fatalf("Expected LSN4 to be greater than %d, got %d", lsn3, lsn4)
+	}
+}
+
+func TestLogMgrEncryption(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logEncryption")
+	os.RemoveAll(tempDir) // clean up any previous runs
+	key := []byte("0123456789abcdef")
+
+	fm, err := file.NewFileMgr(tempDir, 128, file.WithEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	logfile := "testlogfile"
+	logMgr, err := NewLogMgr(fm, logfile)
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+
+	logRec := []byte("sensitive log record")
+	lsn, err := logMgr.Append(logRec)
+	if err != nil {
+		t.Fatalf("Failed to append record: %v", err)
+	}
+	if err := logMgr.Flush(lsn); err != nil {
+		t.Fatalf("Failed to flush logs: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tempDir, SegmentName(logfile, 0)))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if bytes.Contains(raw, logRec) {
+		t.Fatalf("log record is stored in plaintext")
+	}
+
+	fm.Close()
+	fm, err = file.NewFileMgr(tempDir, 128, file.WithEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to reopen FileMgr: %v", err)
+	}
+	logMgr, err = NewLogMgr(fm, logfile)
+	if err != nil {
+		t.Fatalf("Failed to reopen LogMgr: %v", err)
+	}
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	record, err := iter.NextRecord()
+	if err != nil {
+		t.Fatalf("Failed to read record: %v", err)
+	}
+	if !bytes.Equal(record, logRec) {
+		t.Fatalf("Read record doesn't match. Got: %s, Expected: %s", record, logRec)
+	}
+}
+
+func TestForwardLogIterator(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logForward")
+	os.RemoveAll(tempDir) // clean up any previous runs
+
+	fm, err := file.NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err := NewLogMgr(fm, "testlogfile")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+
+	var lsns []int
+	for i := 0; i < 10; i++ {
+		lsn, err := logMgr.Append([]byte(fmt.Sprintf("record %d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append record %d: %v", i, err)
+		}
+		lsns = append(lsns, lsn)
+	}
+
+	iter, err := logMgr.ForwardIterator(0)
+	if err != nil {
+		t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		record, err := iter.NextRecord()
+		if err != nil {
+			t.Fatalf("Failed to read record %d: %v", i, err)
+		}
+		if expected := fmt.Sprintf("record %d", i); string(record) != expected {
+			t.Fatalf("Expected %q, got %q", expected, record)
+		}
+		if iter.LSN() != lsns[i] {
+			t.Fatalf("Expected LSN %d for record %d, got %d", lsns[i], i, iter.LSN())
+		}
+	}
+	if record, err := iter.NextRecord(); record != nil || err != nil {
+		t.Fatalf("Expected no more records, got %q, %v", record, err)
+	}
+
+	// records flushed later are returned by the same iterator
+	lsn, _ := logMgr.Append([]byte("record 10"))
+	logMgr.Flush(lsn)
+	if record, err := iter.NextRecord(); string(record) != "record 10" || err != nil {
+		t.Fatalf("Expected %q, got %q, %v", "record 10", record, err)
+	}
+
+	// seeking to an LSN
+	if err := iter.Seek(lsns[7]); err != nil {
+		t.Fatalf("Failed to seek to LSN %d: %v", lsns[7], err)
+	}
+	if record, err := iter.NextRecord(); string(record) != "record 7" || err != nil {
+		t.Fatalf("Expected %q after seeking, got %q, %v", "record 7", record, err)
+	}
+	if err := iter.Seek(lsns[3] + 1); err != nil {
+		t.Fatalf("Failed to seek to LSN %d: %v", lsns[3]+1, err)
+	}
+	if record, err := iter.NextRecord(); string(record) != "record 4" || err != nil {
+		t.Fatalf("Expected %q after seeking between records, got %q, %v", "record 4", record, err)
+	}
+
+	// iterating backwards doesn't change the log manager's current block
+	backward, _ := logMgr.Iterator()
+	for record, _ := backward.NextRecord(); record != nil; record, _ = backward.NextRecord() {
+	}
+	lsn, err = logMgr.Append([]byte("record 11"))
+	if err != nil || lsn <= lsns[9] {
+		t.Fatalf("Expected LSN after %d, got %d, %v", lsns[9], lsn, err)
+	}
+}
+
+func TestReadOnlyLogIterator(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logReadOnly")
+	os.RemoveAll(tempDir) // clean up any previous runs
+
+	fm, err := file.NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	logMgr, err := NewLogMgr(fm, "testlogfile")
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	lsns := appendRecords(t, logMgr, 5)
+	logMgr.Flush(lsns[4])
+	fm.Close()
+
+	fm, err = file.NewFileMgr(tempDir, 64, file.WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to reopen FileMgr read-only: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err = NewLogMgr(fm, "testlogfile")
+	if err != nil {
+		t.Fatalf("Failed to reopen LogMgr: %v", err)
+	}
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator on a read-only log: %v", err)
+	}
+	for i := 4; i >= 0; i-- {
+		record, err := iter.NextRecord()
+		if err != nil {
+			t.Fatalf("Failed to read record %d: %v", i, err)
+		}
+		if expected := fmt.Sprintf("record %02d", i); string(record) != expected {
+			t.Fatalf("Expected %q, got %q", expected, record)
+		}
+	}
+	if record, err := iter.NextRecord(); record != nil || err != nil {
+		t.Fatalf("Expected no more records, got %q, %v", record, err)
+	}
+	if err := logMgr.CopyTo(file.NewMemStorage()); err != nil {
+		t.Fatalf("Failed to copy a read-only log: %v", err)
+	}
 }
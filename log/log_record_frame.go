@@ -0,0 +1,181 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// CRC_BYTES is the size of the checksum stored in front of every log record.
+const CRC_BYTES = 4
+
+// FRAME_BYTES is the space a log record takes in a log block on top of its own bytes:
+// its length, the checksum of its LSN and bytes, and its LSN.
+const FRAME_BYTES = INTEGER_BYTES + CRC_BYTES + LSN_BYTES
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptRecord is returned when a log record doesn't match its checksum,
+// e.g. because the write of its block was torn by a crash.
+var ErrCorruptRecord = errors.New("corrupt log record")
+
+// writeRecord frames logrec with its length, checksum and LSN at offset recpos of p.
+func writeRecord(p *file.Page, recpos int, lsn int, logrec []byte) error {
+	if err := p.SetInt(recpos, CRC_BYTES+LSN_BYTES+len(logrec)); err != nil {
+		return err
+	}
+	if err := p.SetInt64(recpos+INTEGER_BYTES+CRC_BYTES, int64(lsn)); err != nil {
+		return err
+	}
+	if err := p.SetFixedBytes(recpos+FRAME_BYTES, logrec); err != nil {
+		return err
+	}
+	b, _ := p.GetFixedBytes(recpos+INTEGER_BYTES+CRC_BYTES, LSN_BYTES+len(logrec))
+	return p.SetFixedBytes(recpos+INTEGER_BYTES, file.Encoding.AppendUint32(nil, crc32.Checksum(b, crcTable)))
+}
+
+// readRecord returns the LSN and bytes of the record framed at offset recpos of p,
+// checking them against the record's checksum.
+func readRecord(p *file.Page, recpos int) (int, []byte, error) {
+	b, err := p.GetBytes(recpos)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < CRC_BYTES+LSN_BYTES {
+		return 0, nil, fmt.Errorf("%w: %d-byte record is too short", ErrCorruptRecord, len(b))
+	}
+	stored := file.Encoding.Uint32(b)
+	if computed := crc32.Checksum(b[CRC_BYTES:], crcTable); stored != computed {
+		return 0, nil, fmt.Errorf("%w: stored checksum %08x, computed %08x", ErrCorruptRecord, stored, computed)
+	}
+	return int(file.Encoding.Uint64(b[CRC_BYTES:])), b[CRC_BYTES+LSN_BYTES:], nil
+}
+
+// validTail returns true if the records from offset pos of log block blknum
+// follow each other, with valid checksums and LSNs, up to the end of the block.
+func validTail(p *file.Page, blknum int, pos int) bool {
+	blockSize := len(p.Contents())
+	for pos < blockSize {
+		lsn, b, err := readRecord(p, pos)
+		if err != nil || lsn != lsnAt(blockSize, blknum, pos) {
+			return false
+		}
+		pos += FRAME_BYTES + len(b)
+	}
+	return pos == blockSize
+}
+
+// TailCopyName returns the name of the file holding the copy of the last block of the log
+// named logfile.
+func TailCopyName(logfile string) string {
+	return logfile + ".tail"
+}
+
+// writeTailCopy writes lm.logpage to the tail copy and syncs it.
+// flush rewrites the last log block in place, and a crash can tear the rewrite:
+// the block is therefore first written to the tail copy, so that the records flushed before
+// can be read back from one or the other.
+func (lm *LogMgr) writeTailCopy() error {
+	blk := file.NewBlockId(TailCopyName(lm.logfile), 0)
+	size, err := lm.fm.Length(blk.Filename)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if _, err := lm.fm.Append(blk.Filename); err != nil {
+			return err
+		}
+	}
+	if err := lm.fm.Write(blk, lm.logpage); err != nil {
+		return err
+	}
+	return lm.fm.Sync(blk.Filename)
+}
+
+// readTailCopy reads the tail copy into lm.logpage if it holds records of log block blknum,
+// all completely written. Returns false, leaving lm.logpage unchanged, if it doesn't.
+func (lm *LogMgr) readTailCopy(blknum int) (bool, error) {
+	blk := file.NewBlockId(TailCopyName(lm.logfile), 0)
+	size, err := lm.fm.Length(blk.Filename)
+	if err != nil || size == 0 {
+		return false, err
+	}
+	p := file.NewPage(lm.fm.BlockSize())
+	if err := lm.fm.Read(blk, p); err != nil {
+		var corrupt *file.CorruptBlockError
+		if errors.As(err, &corrupt) || errors.Is(err, file.ErrDecryption) {
+			return false, nil
+		}
+		return false, err
+	}
+	boundary, _ := p.GetInt(0)
+	if boundary < INTEGER_BYTES || boundary >= len(p.Contents()) || !validTail(p, blknum, boundary) {
+		return false, nil
+	}
+	copy(lm.logpage.Contents(), p.Contents())
+	return true, nil
+}
+
+// repairTail makes sure that the boundary of the last log block, held in lm.logpage,
+// points to records that were completely written.
+// A crash during a flush can leave the block torn, with a boundary pointing to records
+// that were only partly written, or failing its checksum or decryption.
+// The block is then replaced by the tail copy written before it, which holds every
+// flushed record. If the copy is of no use, the crash tore it before the block was
+// rewritten, so this only happens to a block that was never flushed in place:
+// the boundary is moved to the first intact record, and the block is emptied
+// if it can't be read at all. The repaired block is written back.
+// A read-only log is only repaired in memory.
+// Returns the LSN the log was truncated at, or -1 if no flushed record was lost.
+func (lm *LogMgr) repairTail(readErr error) (int, error) {
+	blockSize := lm.fm.BlockSize()
+	blknum := lm.currentblk.Blknum
+	if readErr != nil {
+		var corrupt *file.CorruptBlockError
+		if !errors.As(readErr, &corrupt) && !errors.Is(readErr, file.ErrDecryption) {
+			return -1, readErr
+		}
+	} else {
+		boundary, _ := lm.logpage.GetInt(0)
+		if boundary >= INTEGER_BYTES && boundary <= blockSize && validTail(lm.logpage, blknum, boundary) {
+			return -1, nil
+		}
+	}
+
+	truncatedLSN := -1
+	copied, err := lm.readTailCopy(blknum)
+	if err != nil {
+		return -1, fmt.Errorf("reading log tail copy: %w", err)
+	}
+	if !copied {
+		pos := blockSize
+		if readErr != nil {
+			clear(lm.logpage.Contents())
+		} else {
+			boundary, _ := lm.logpage.GetInt(0)
+			for pos = max(boundary, INTEGER_BYTES); pos < blockSize; pos++ {
+				if validTail(lm.logpage, blknum, pos) {
+					break
+				}
+			}
+		}
+		lm.logpage.SetInt(0, pos)
+		truncatedLSN = lsnAt(blockSize, blknum, pos)
+	}
+
+	lm.tailRepaired = true
+	if lm.fm.IsReadOnly() {
+		// the repaired block can't be written back, readBlock serves it from memory
+		return truncatedLSN, nil
+	}
+	segblk := lm.segmentBlock(blknum)
+	if err := lm.fm.Write(segblk, lm.logpage); err != nil {
+		return -1, fmt.Errorf("writing repaired log block: %w", err)
+	}
+	if err := lm.fm.Sync(segblk.Filename); err != nil {
+		return -1, fmt.Errorf("syncing repaired log block: %w", err)
+	}
+	return truncatedLSN, nil
+}
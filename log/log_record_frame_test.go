@@ -0,0 +1,98 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+func TestTornLogTail(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     []file.Option
+		copyLost bool // the crash tore the tail copy as well
+	}{
+		{"plain", nil, false},
+		{"checksums", []file.Option{file.WithChecksums()}, false},
+		{"plain without copy", nil, true},
+		{"checksums without copy", []file.Option{file.WithChecksums()}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := filepath.Join(os.TempDir(), "logTorn")
+			os.RemoveAll(tempDir) // clean up any previous runs
+			segment := filepath.Join(tempDir, SegmentName("testlog", 0))
+
+			fm, err := file.NewFileMgr(tempDir, 128, tc.opts...)
+			if err != nil {
+				t.Fatalf("Failed to create FileMgr: %v", err)
+			}
+			logMgr, err := NewLogMgr(fm, "testlog")
+			if err != nil {
+				t.Fatalf("Failed to create LogMgr: %v", err)
+			}
+			lsns := appendRecords(t, logMgr, 2)
+			logMgr.Flush(lsns[1])
+			before, _ := os.ReadFile(segment)
+			lsns = append(lsns, appendRecords(t, logMgr, 1)...)
+			logMgr.Flush(lsns[2])
+			after, _ := os.ReadFile(segment)
+			fm.Close()
+
+			// the crash left the new boundary on disk, but not the third record
+			torn := append(after[:4:4], before[4:]...)
+			os.WriteFile(segment, torn, 0666)
+			if tc.copyLost {
+				os.Remove(filepath.Join(tempDir, TailCopyName("testlog")))
+			}
+
+			fm, err = file.NewFileMgr(tempDir, 128, tc.opts...)
+			if err != nil {
+				t.Fatalf("Failed to reopen FileMgr: %v", err)
+			}
+			defer fm.Close()
+			logMgr, err = NewLogMgr(fm, "testlog")
+			if err != nil {
+				t.Fatalf("Failed to reopen LogMgr: %v", err)
+			}
+			lsn, truncated := logMgr.TruncatedLSN()
+
+			var records []string
+			iter, _ := logMgr.Iterator()
+			for record, err := iter.NextRecord(); record != nil || err != nil; record, err = iter.NextRecord() {
+				if err != nil {
+					t.Fatalf("Failed to read record: %v", err)
+				}
+				records = append(records, string(record))
+			}
+			switch {
+			case !tc.copyLost:
+				// the flushed records are read back from the tail copy
+				if truncated || len(records) != 3 || records[1] != "record 01" {
+					t.Errorf("Expected the three flushed records, got %q, truncated: %v", records, truncated)
+				}
+				lsn = lsns[2]
+			case !truncated:
+				t.Fatalf("Expected the torn tail to be reported")
+			case tc.opts == nil:
+				// the intact records are kept
+				if lsn != lsns[1] {
+					t.Errorf("Expected the log to be truncated after LSN %d, got %d", lsns[1], lsn)
+				}
+				if len(records) != 2 || records[0] != "record 01" {
+					t.Errorf("Expected the two intact records, got %q", records)
+				}
+			case lsn != 0 || len(records) != 0:
+				// the block fails its checksum, so it is emptied
+				t.Errorf("Expected the whole block to be truncated, got LSN %d and records %q", lsn, records)
+			}
+
+			// appending continues after the last record
+			next, err := logMgr.Append([]byte("record 03"))
+			if err != nil || next <= lsn {
+				t.Fatalf("Expected LSN after %d, got %d, %v", lsn, next, err)
+			}
+		})
+	}
+}
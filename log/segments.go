@@ -0,0 +1,223 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// DEFAULT_SEGMENT_BLOCKS is the number of blocks of a log segment file unless WithSegmentBlocks is used.
+const DEFAULT_SEGMENT_BLOCKS = 1024
+
+// ErrSegmentReleased is returned when reading log records from a segment
+// that was released by the retention policy.
+var ErrSegmentReleased = errors.New("log segment was released")
+
+// Option configures optional LogMgr behaviour.
+type Option func(*LogMgr)
+
+// WithSegmentBlocks sets the number of blocks of each log segment file.
+// A log must always be opened with the segment size it was created with.
+func WithSegmentBlocks(n int) Option {
+	return func(lm *LogMgr) {
+		lm.segmentBlocks = n
+	}
+}
+
+// WithRetention sets the policy applied to the segments released by TruncateBefore.
+// By default, segments are kept.
+func WithRetention(policy RetentionPolicy) Option {
+	return func(lm *LogMgr) {
+		lm.retention = policy
+	}
+}
+
+// RetentionPolicy decides what becomes of log segments that recovery no longer needs.
+type RetentionPolicy interface {
+	Release(fm *file.FileMgr, segment string) error
+}
+
+// DeleteSegments is a RetentionPolicy that removes released segments.
+type DeleteSegments struct{}
+
+func (DeleteSegments) Release(fm *file.FileMgr, segment string) error {
+	return fm.Remove(segment)
+}
+
+// ArchiveSegments is a RetentionPolicy that moves released segments to the directory Dir.
+type ArchiveSegments struct {
+	Dir string
+}
+
+func (a ArchiveSegments) Release(fm *file.FileMgr, segment string) error {
+	archive, err := file.NewOSStorage(a.Dir)
+	if err != nil {
+		return err
+	}
+	// a previous attempt may have stopped between copying and removing the segment
+	if err := archive.Remove(segment); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := fm.CopyFile(segment, archive); err != nil {
+		return err
+	}
+	return fm.Remove(segment)
+}
+
+// SegmentName returns the name of the segment file of logfile numbered segment.
+func SegmentName(logfile string, segment int) string {
+	return fmt.Sprintf("%s.%06d", logfile, segment)
+}
+
+// parseSegment returns the number of the segment of logfile named filename,
+// or -1 if filename isn't a segment of logfile.
+func parseSegment(logfile string, filename string) int {
+	suffix, ok := strings.CutPrefix(filename, logfile+".")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 0 || SegmentName(logfile, n) != filename {
+		return -1
+	}
+	return n
+}
+
+// segments returns the numbers of the existing segment files, in increasing order.
+func (lm *LogMgr) segments() ([]int, error) {
+	files, err := lm.fm.Files()
+	if err != nil {
+		return nil, fmt.Errorf("listing log segments: %w", err)
+	}
+	var segments []int
+	for _, filename := range files {
+		if n := parseSegment(lm.logfile, filename); n >= 0 {
+			segments = append(segments, n)
+		}
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+// IsSegment returns true if filename is a segment file of the log named logfile.
+func IsSegment(logfile string, filename string) bool {
+	return parseSegment(logfile, filename) >= 0
+}
+
+// IsLogFile returns true if filename is one of the segment files of the log or its tail copy.
+func (lm *LogMgr) IsLogFile(filename string) bool {
+	return IsSegment(lm.logfile, filename) || filename == TailCopyName(lm.logfile)
+}
+
+// FirstLSN returns the smallest LSN a record that can still be read through the LogMgr may have,
+// that is, the first LSN of the oldest segment that wasn't released.
+func (lm *LogMgr) FirstLSN() int {
+	lm.Lock()
+	defer lm.Unlock()
+	return lm.firstBlk*lm.fm.BlockSize() + 1
+}
+
+// segmentBlock returns the block of a segment file holding log block blknum.
+func (lm *LogMgr) segmentBlock(blknum int) *file.BlockId {
+	return file.NewBlockId(SegmentName(lm.logfile, blknum/lm.segmentBlocks), blknum%lm.segmentBlocks)
+}
+
+// readBlock reads log block blknum into p.
+func (lm *LogMgr) readBlock(blknum int, p *file.Page) error {
+	if blknum < lm.firstBlk {
+		return fmt.Errorf("reading log block %d: %w", blknum, ErrSegmentReleased)
+	}
+	if lm.tailRepaired && lm.fm.IsReadOnly() && blknum == lm.currentblk.Blknum {
+		// the torn block on disk was repaired in memory only
+		copy(p.Contents(), lm.logpage.Contents())
+		return nil
+	}
+	blk := lm.segmentBlock(blknum)
+	if err := lm.fm.Read(blk, p); err != nil {
+		return fmt.Errorf("reading log block %d from %v: %w", blknum, blk, err)
+	}
+	return nil
+}
+
+// TruncateBefore applies the retention policy to the segments that only hold records
+// older than lsn, which is typically the LSN of a checkpoint record.
+// Their records can no longer be read through the LogMgr.
+func (lm *LogMgr) TruncateBefore(lsn int) error {
+	if lm.retention == nil {
+		return nil
+	}
+	lm.Lock()
+	segments, err := lm.segments()
+	if err != nil {
+		lm.Unlock()
+		return err
+	}
+	lsnSegment := max(lsn-1, 0) / lm.fm.BlockSize() / lm.segmentBlocks
+	currentSegment := lm.currentblk.Blknum / lm.segmentBlocks
+	var released []int
+	for _, s := range segments {
+		if s < lsnSegment && s < currentSegment {
+			released = append(released, s)
+			lm.firstBlk = max(lm.firstBlk, (s+1)*lm.segmentBlocks)
+		}
+	}
+	lm.Unlock()
+
+	for _, s := range released {
+		if err := lm.retention.Release(lm.fm, SegmentName(lm.logfile, s)); err != nil {
+			return fmt.Errorf("releasing log segment %d: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// TruncateAfter removes the records appended after the record at lsn, which becomes the latest one.
+// It is used to restore a log to a point in time, and must not be called while records are appended.
+func (lm *LogMgr) TruncateAfter(lsn int) error {
+	lm.Lock()
+	defer lm.Unlock()
+	if lsn >= lm.latestLSN {
+		return nil
+	}
+	blockSize := lm.fm.BlockSize()
+	blknum := max(lsn-1, 0) / blockSize
+	p := file.NewPage(blockSize)
+	if err := lm.readBlock(blknum, p); err != nil {
+		return err
+	}
+	positions, err := recordPositions(p)
+	if err != nil {
+		return fmt.Errorf("reading log block %d: %w", blknum, err)
+	}
+	recpos := lsnAt(blockSize, blknum, 0) - lsn
+	if recpos != blockSize && !slices.Contains(positions, recpos) {
+		return fmt.Errorf("truncating log: no record at LSN %d", lsn)
+	}
+
+	segments, err := lm.segments()
+	if err != nil {
+		return err
+	}
+	segment := blknum / lm.segmentBlocks
+	for _, s := range segments {
+		if s > segment {
+			if err := lm.fm.Remove(SegmentName(lm.logfile, s)); err != nil {
+				return fmt.Errorf("removing log segment %d: %w", s, err)
+			}
+		}
+	}
+	segblk := lm.segmentBlock(blknum)
+	if err := lm.fm.Truncate(segblk.Filename, segblk.Blknum+1); err != nil {
+		return err
+	}
+	p.SetInt(0, recpos)
+	lm.logpage = p
+	lm.currentblk = file.NewBlockId(lm.logfile, blknum)
+	lm.latestLSN = lsn
+	return lm.flush()
+}
@@ -0,0 +1,148 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// appendRecords appends n numbered records and returns their LSNs.
+func appendRecords(t *testing.T, lm *LogMgr, n int) []int {
+	var lsns []int
+	for i := 0; i < n; i++ {
+		lsn, err := lm.Append([]byte(fmt.Sprintf("record %02d", i)))
+		if err != nil {
+			t.Fatalf("Failed to append record %d: %v", i, err)
+		}
+		lsns = append(lsns, lsn)
+	}
+	return lsns
+}
+
+func TestLogSegments(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logSegments")
+	os.RemoveAll(tempDir) // clean up any previous runs
+
+	fm, err := file.NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	// two 25-byte records per block, two blocks per segment
+	logMgr, err := NewLogMgr(fm, "testlog", WithSegmentBlocks(2))
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	lsns := appendRecords(t, logMgr, 20)
+	logMgr.Flush(lsns[19])
+
+	for s := 0; s < 5; s++ {
+		if n, _ := fm.Length(SegmentName("testlog", s)); n != 2 {
+			t.Errorf("Segment %d has %d blocks, expected 2", s, n)
+		}
+	}
+
+	// iterators cross segments
+	iter, err := logMgr.Iterator()
+	if err != nil {
+		t.Fatalf("Failed to create LogIterator: %v", err)
+	}
+	for i := 19; i >= 0; i-- {
+		record, err := iter.NextRecord()
+		if expected := fmt.Sprintf("record %02d", i); string(record) != expected || err != nil {
+			t.Fatalf("Expected %q, got %q, %v", expected, record, err)
+		}
+	}
+	forward, err := logMgr.ForwardIterator(lsns[5])
+	if err != nil {
+		t.Fatalf("Failed to create ForwardLogIterator: %v", err)
+	}
+	for i := 5; i < 20; i++ {
+		record, err := forward.NextRecord()
+		if expected := fmt.Sprintf("record %02d", i); string(record) != expected || err != nil {
+			t.Fatalf("Expected %q, got %q, %v", expected, record, err)
+		}
+	}
+
+	// the log continues in the last segment after a restart
+	fm.Close()
+	fm, err = file.NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("Failed to reopen FileMgr: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err = NewLogMgr(fm, "testlog", WithSegmentBlocks(2), WithRetention(DeleteSegments{}))
+	if err != nil {
+		t.Fatalf("Failed to reopen LogMgr: %v", err)
+	}
+	lsn, err := logMgr.Append([]byte("record 20"))
+	if err != nil || lsn <= lsns[19] {
+		t.Fatalf("Expected LSN after %d, got %d, %v", lsns[19], lsn, err)
+	}
+	logMgr.Flush(lsn)
+	if n, _ := fm.Length(SegmentName("testlog", 5)); n != 1 {
+		t.Errorf("Segment 5 has %d blocks, expected 1", n)
+	}
+
+	// segments before the one holding record 09 are deleted
+	if err := logMgr.TruncateBefore(lsns[9]); err != nil {
+		t.Fatalf("TruncateBefore(%d) error = %v", lsns[9], err)
+	}
+	for s := 0; s < 2; s++ {
+		if _, err := os.Stat(filepath.Join(tempDir, SegmentName("testlog", s))); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Segment %d still exists, Stat error = %v", s, err)
+		}
+	}
+	iter, _ = logMgr.Iterator()
+	count := 0
+	for record, err := iter.NextRecord(); record != nil || err != nil; record, err = iter.NextRecord() {
+		if err != nil {
+			t.Fatalf("Failed to read record: %v", err)
+		}
+		count++
+	}
+	if count != 13 {
+		t.Errorf("Iterator returned %d records, expected the 13 of the remaining segments", count)
+	}
+	if _, err := logMgr.ForwardIterator(lsns[0]); !errors.Is(err, ErrSegmentReleased) {
+		t.Errorf("ForwardIterator at a released LSN error = %v, expected %v", err, ErrSegmentReleased)
+	}
+}
+
+func TestLogSegmentArchive(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "logArchive")
+	archiveDir := filepath.Join(os.TempDir(), "logArchiveSegments")
+	os.RemoveAll(tempDir) // clean up any previous runs
+	os.RemoveAll(archiveDir)
+
+	fm, err := file.NewFileMgr(tempDir, 64)
+	if err != nil {
+		t.Fatalf("Failed to create FileMgr: %v", err)
+	}
+	defer fm.Close()
+	logMgr, err := NewLogMgr(fm, "testlog", WithSegmentBlocks(2), WithRetention(ArchiveSegments{Dir: archiveDir}))
+	if err != nil {
+		t.Fatalf("Failed to create LogMgr: %v", err)
+	}
+	lsns := appendRecords(t, logMgr, 12)
+	logMgr.Flush(lsns[11])
+
+	if err := logMgr.TruncateBefore(lsns[11]); err != nil {
+		t.Fatalf("TruncateBefore(%d) error = %v", lsns[11], err)
+	}
+	for s := 0; s < 2; s++ {
+		name := SegmentName("testlog", s)
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Segment %d still exists, Stat error = %v", s, err)
+		}
+		if _, err := os.Stat(filepath.Join(archiveDir, name)); err != nil {
+			t.Errorf("Segment %d was not archived: %v", s, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, SegmentName("testlog", 2))); err != nil {
+		t.Errorf("Segment 2 holding the LSN was released: %v", err)
+	}
+}
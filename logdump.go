@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/server"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+// logFilter selects the log records printed by logdump. Negative numbers and empty values match everything.
+type logFilter struct {
+	txnum    int
+	filename string
+	blknum   int
+	ops      map[int]bool
+}
+
+// match returns true if r passes the filter.
+// Records that don't modify a block don't pass a file or block filter.
+func (f logFilter) match(r tx.LogRecord) bool {
+	if f.txnum >= 0 && r.TxNumber() != f.txnum {
+		return false
+	}
+	if len(f.ops) > 0 && !f.ops[r.Op()] {
+		return false
+	}
+	if f.filename == "" && f.blknum < 0 {
+		return true
+	}
+	blk := recordBlock(r)
+	if blk == nil {
+		return false
+	}
+	return (f.filename == "" || blk.Filename == f.filename) && (f.blknum < 0 || blk.Blknum == f.blknum)
+}
+
+// recordBlock returns the block modified by r, or nil if r doesn't modify a block.
+func recordBlock(r tx.LogRecord) *file.BlockId {
+	switch r := r.(type) {
+	case *tx.SetIntRecord:
+		return r.Block()
+	case *tx.SetStringRecord:
+		return r.Block()
+	}
+	return nil
+}
+
+// jsonLogRecord is the JSON form of a log record.
+type jsonLogRecord struct {
+	LSN    int    `json:"lsn"`
+	Op     string `json:"op"`
+	TxNum  *int   `json:"txnum,omitempty"`
+	File   string `json:"file,omitempty"`
+	Block  *int   `json:"block,omitempty"`
+	Offset *int   `json:"offset,omitempty"`
+	OldVal any    `json:"oldval,omitempty"`
+	NewVal any    `json:"newval,omitempty"`
+	Time   string `json:"time,omitempty"`
+}
+
+func newJSONLogRecord(lsn int, r tx.LogRecord) jsonLogRecord {
+	j := jsonLogRecord{LSN: lsn, Op: tx.OpName(r.Op())}
+	if r.Op() != tx.CHECKPOINT {
+		txnum := r.TxNumber()
+		j.TxNum = &txnum
+	}
+	switch r := r.(type) {
+	case *tx.SetIntRecord:
+		blknum, offset := r.Block().Blknum, r.Offset()
+		j.File, j.Block, j.Offset, j.OldVal, j.NewVal = r.Block().Filename, &blknum, &offset, r.OldVal(), r.NewVal()
+	case *tx.SetStringRecord:
+		blknum, offset := r.Block().Blknum, r.Offset()
+		j.File, j.Block, j.Offset, j.OldVal, j.NewVal = r.Block().Filename, &blknum, &offset, r.OldVal(), r.NewVal()
+	case *tx.CommitRecord:
+		if !r.Time().IsZero() {
+			j.Time = r.Time().Format(time.RFC3339Nano)
+		}
+	}
+	return j
+}
+
+// dumpLog writes the records of the log that pass filter to w, oldest first,
+// one per line, either as text or as JSON objects.
+func dumpLog(w io.Writer, lm *log.LogMgr, filter logFilter, asJSON bool) error {
+	it, err := lm.ForwardIterator(lm.FirstLSN())
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for {
+		b, err := it.NextRecord()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return nil
+		}
+		r, err := tx.CreateLogRecord(b)
+		if err != nil {
+			return fmt.Errorf("decoding log record at LSN %d: %w", it.LSN(), err)
+		}
+		if !filter.match(r) {
+			continue
+		}
+		if asJSON {
+			err = enc.Encode(newJSONLogRecord(it.LSN(), r))
+		} else {
+			_, err = fmt.Fprintf(w, "%d %v\n", it.LSN(), r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logdump prints the log records of a database, which is opened read-only.
+func logdump(args []string) error {
+	fs := flag.NewFlagSet("logdump", flag.ExitOnError)
+	dir := fs.String("dir", "", "database directory")
+	txnum := fs.Int("tx", -1, "only print the records of this transaction")
+	filename := fs.String("file", "", "only print the records modifying this file")
+	blknum := fs.Int("block", -1, "only print the records modifying this block number")
+	types := fs.String("type", "", "only print records of these comma-separated types, e.g. START,COMMIT")
+	asJSON := fs.Bool("json", false, "print one JSON object per record")
+	blockSize, opts := dbFlags(fs)
+	fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("-dir is required")
+	}
+
+	filter := logFilter{txnum: *txnum, filename: *filename, blknum: *blknum, ops: map[int]bool{}}
+	if *types != "" {
+		for _, name := range strings.Split(*types, ",") {
+			op, err := tx.ParseOp(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			filter.ops[op] = true
+		}
+	}
+
+	db, err := server.NewCefDB(*dir, *blockSize, server.BUFFER_SIZE, append(opts(), server.WithFileOptions(file.WithReadOnly()))...)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return dumpLog(os.Stdout, db.LogMgr(), filter, *asJSON)
+}
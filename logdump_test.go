@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/server"
+	"github.com/CefBoud/CefDB/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogDump(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "TestLogDump")
+	_ = os.RemoveAll(dir) // Clean any previous test data
+
+	db, err := server.NewCefDB(dir, server.BLOCK_SIZE, server.BUFFER_SIZE)
+	assert.NoError(t, err)
+	committed := db.NewTx()
+	blk, err := committed.Append("a.tbl")
+	assert.NoError(t, err)
+	committed.Pin(blk)
+	assert.NoError(t, committed.SetInt(blk, 0, 42, true))
+	assert.NoError(t, committed.SetString(blk, 8, "hello", true))
+	committed.Commit()
+	rolledBack := db.NewTx()
+	other, err := rolledBack.Append("b.tbl")
+	assert.NoError(t, err)
+	rolledBack.Pin(other)
+	assert.NoError(t, rolledBack.SetInt(other, 0, 7, true))
+	rolledBack.Rollback()
+	assert.NoError(t, db.Close())
+
+	db, err = server.NewCefDB(dir, server.BLOCK_SIZE, server.BUFFER_SIZE, server.WithFileOptions(file.WithReadOnly()))
+	assert.NoError(t, err)
+	defer db.Close()
+	dump := func(filter logFilter, asJSON bool) string {
+		var out bytes.Buffer
+		assert.NoError(t, dumpLog(&out, db.LogMgr(), filter, asJSON))
+		return out.String()
+	}
+	all := logFilter{txnum: -1, blknum: -1}
+
+	text := dump(all, false)
+	for _, op := range []string{"START", "COMMIT", "ROLLBACK", "SETINT", "SETSTRING"} {
+		assert.Contains(t, text, "Op: "+op)
+	}
+
+	var records []jsonLogRecord
+	for _, line := range strings.Split(strings.TrimSpace(dump(logFilter{txnum: -1, filename: "a.tbl", blknum: -1}, true)), "\n") {
+		var r jsonLogRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &r))
+		records = append(records, r)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "SETINT", records[0].Op)
+		assert.Equal(t, 42.0, records[0].NewVal)
+		assert.Equal(t, "SETSTRING", records[1].Op)
+		assert.Equal(t, "hello", records[1].NewVal)
+		assert.Equal(t, 8, *records[1].Offset)
+		assert.Less(t, records[0].LSN, records[1].LSN)
+	}
+
+	txFilter := logFilter{txnum: *records[0].TxNum, blknum: -1}
+	assert.Equal(t, 4, strings.Count(dump(txFilter, false), "\n")) // START, SETINT, SETSTRING, COMMIT
+	txFilter.ops = map[int]bool{tx.COMMIT: true}
+	assert.Equal(t, 1, strings.Count(dump(txFilter, false), "\n"))
+	assert.Empty(t, dump(logFilter{txnum: -1, filename: "b.tbl", blknum: 1}, false))
+}
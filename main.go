@@ -1,20 +1,146 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/server"
 )
 
+const usage = `usage: cefdb <command> [flags]
+
+commands:
+  backup   copy a database to a backup directory, or ask the process running it to
+  restore  restore a backup to a new database directory, optionally to a point in time
+  logdump  print the write-ahead log records of a database
+
+Run 'cefdb <command> -h' for the flags of a command.
+`
+
 func main() {
-	fmt.Println("yes")
-	p := file.NewPage(4096)
-	p.SetInt(0, 5)
-	p.SetBytes(10, []byte{1, 2})
-	p.SetString(100, "toto")
-
-	i := p.GetInt(0)
-	b := p.GetBytes(10)
-	s := p.GetString(100)
-	fmt.Printf("i=%v   b=%v   s=%v", i, b, s)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = backup(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	case "logdump":
+		err = logdump(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cefdb %v: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// dbFlags registers the flags describing how a database was created.
+func dbFlags(fs *flag.FlagSet) (blockSize *int, opts func() []server.Option) {
+	blockSize = fs.Int("blocksize", server.BLOCK_SIZE, "block size of the database")
+	segmentBlocks := fs.Int("segmentblocks", log.DEFAULT_SEGMENT_BLOCKS, "number of blocks of the log segments of the database")
+	checksums := fs.Bool("checksums", false, "the database was created with block checksums")
+	key := fs.String("key", "", "encryption key of the database, if any")
+	return blockSize, func() []server.Option {
+		var opts []file.Option
+		if *checksums {
+			opts = append(opts, file.WithChecksums())
+		}
+		if *key != "" {
+			opts = append(opts, file.WithEncryption([]byte(*key)))
+		}
+		return []server.Option{
+			server.WithFileOptions(opts...),
+			server.WithLogOptions(log.WithSegmentBlocks(*segmentBlocks)),
+		}
+	}
+}
+
+// backup copies the database. A database another process has open is locked, so it can only
+// be backed up by that process: with -addr, the command asks it to, through the address
+// it serves backups on with CefDB.ServeBackups. Otherwise the command opens the database itself.
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := fs.String("dir", "", "database directory, when no other process has the database open")
+	addr := fs.String("addr", "", "TCP address of the running process to ask for a backup, instead of -dir")
+	to := fs.String("to", "", "backup directory, which must not exist or be empty")
+	blockSize, opts := dbFlags(fs)
+	fs.Parse(args)
+	if (*dir == "") == (*addr == "") || *to == "" {
+		return fmt.Errorf("-to and one of -dir or -addr are required")
+	}
+
+	if *addr != "" {
+		// the server opens the backup directory, which may not share our working directory
+		dst, err := filepath.Abs(*to)
+		if err != nil {
+			return err
+		}
+		conn, err := net.Dial("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return server.RequestBackup(conn, dst)
+	}
+
+	if _, err := os.Stat(*dir); err != nil {
+		return err
+	}
+	db, err := server.NewCefDB(*dir, *blockSize, server.BUFFER_SIZE, opts()...)
+	if errors.Is(err, file.ErrLocked) {
+		return fmt.Errorf("%w: back up a running database with -addr", err)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Backup(*to)
+}
+
+// restore restores a backup, either as it was when it was taken
+// or, if a recovery target is given, up to that point of the log.
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "backup directory")
+	dir := fs.String("dir", "", "database directory to restore to, which must not exist or be empty")
+	logs := fs.String("logs", "", "comma-separated directories holding later log segments, for a point-in-time restore")
+	toLSN := fs.Int("to-lsn", 0, "restore up to this LSN")
+	toTx := fs.Int("to-tx", 0, "restore up to the completion of this transaction")
+	toTime := fs.String("to-time", "", "restore the transactions committed at or before this RFC 3339 time")
+	blockSize, opts := dbFlags(fs)
+	fs.Parse(args)
+	if *from == "" || *dir == "" {
+		return fmt.Errorf("-from and -dir are required")
+	}
+
+	target := server.RecoveryTarget{LSN: *toLSN, TxNum: *toTx}
+	if *toTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, *toTime)
+		if err != nil {
+			return fmt.Errorf("parsing -to-time: %w", err)
+		}
+		target.Time = t
+	}
+	if target == (server.RecoveryTarget{}) {
+		return server.Restore(*from, *dir, *blockSize, opts()...)
+	}
+	var logDirs []string
+	if *logs != "" {
+		logDirs = strings.Split(*logs, ",")
+	}
+	return server.RestoreToPoint(*from, logDirs, *dir, *blockSize, target, opts()...)
 }
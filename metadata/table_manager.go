@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/CefBoud/CefDB/record"
@@ -45,24 +46,34 @@ func (tm *TableMgr) CreateTable(tblname string, sch *record.Schema, tx *tx.Trans
 	if err != nil {
 		return fmt.Errorf("Error CreateTable '%v' : %v", tblname, err)
 	}
-	ts.Insert()
-	ts.SetString("tblname", tblname)
-	ts.SetInt("slotsize", l.SlotSize)
+	err = errors.Join(
+		ts.Insert(),
+		ts.SetString("tblname", tblname),
+		ts.SetInt("slotsize", l.SlotSize),
+	)
 	ts.Close()
+	if err != nil {
+		return fmt.Errorf("Error CreateTable '%v' : %w", tblname, err)
+	}
 
 	ts, err = record.NewTableScan(tx, FieldCatalogName, tm.fieldCatalogLayout)
 	if err != nil {
 		return fmt.Errorf("Error CreateTable '%v' : %v", tblname, err)
 	}
+	defer ts.Close()
 	for field, fieldInfo := range l.Schema.Fields {
-		ts.Insert()
-		ts.SetString("tblname", tblname)
-		ts.SetString("fldname", field)
-		ts.SetInt("type", fieldInfo.Type)
-		ts.SetInt("length", fieldInfo.Length)
-		ts.SetInt("offset", l.Offset(field))
+		err = errors.Join(
+			ts.Insert(),
+			ts.SetString("tblname", tblname),
+			ts.SetString("fldname", field),
+			ts.SetInt("type", fieldInfo.Type),
+			ts.SetInt("length", fieldInfo.Length),
+			ts.SetInt("offset", l.Offset(field)),
+		)
+		if err != nil {
+			return fmt.Errorf("Error CreateTable '%v' : %w", tblname, err)
+		}
 	}
-	ts.Close()
 	return nil
 }
 
@@ -72,15 +83,19 @@ func (tm *TableMgr) GetLayout(tblname string, tx *tx.Transaction) (*record.Layou
 	if err != nil {
 		return nil, fmt.Errorf("error GetLayout '%v' : %v", tblname, err)
 	}
+	defer fieldTableScan.Close()
 	for fieldTableScan.Next() {
 		t, err := fieldTableScan.GetString("tblname")
 		if err != nil {
 			return nil, fmt.Errorf("Error GetLayout '%v' : %v", tblname, err)
 		}
 		if t == tblname {
-			fname, _ := fieldTableScan.GetString("fldname")
-			ftype, _ := fieldTableScan.GetInt("type")
-			flength, _ := fieldTableScan.GetInt("length")
+			fname, err1 := fieldTableScan.GetString("fldname")
+			ftype, err2 := fieldTableScan.GetInt("type")
+			flength, err3 := fieldTableScan.GetInt("length")
+			if err := errors.Join(err1, err2, err3); err != nil {
+				return nil, fmt.Errorf("Error GetLayout '%v' : %w", tblname, err)
+			}
 			sch.AddField(fname, ftype, flength)
 		}
 	}
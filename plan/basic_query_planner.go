@@ -18,9 +18,13 @@ func NewBasicQueryPlan(md *metadata.MetadataMgr) *BasicQueryPlan {
 
 func (bqp *BasicQueryPlan) CreatePlan(data *parser.QueryData, tx *tx.Transaction) (Plan, error) {
 	var plan Plan
-	var tablePlans []*TablePlan
+	var tablePlans []Plan
 
 	for _, table := range data.TableList {
+		if table == STATS_TABLE {
+			tablePlans = append(tablePlans, NewStatsPlan(tx))
+			continue
+		}
 		tp, err := NewTablePlan(table, tx, bqp.Md)
 		if err != nil {
 			return nil, fmt.Errorf("createPlan NewTablePlan error : %v", err)
@@ -19,6 +19,9 @@ func NewBasicUpdatePlanner(md *metadata.MetadataMgr) *BasicUpdatePlanner {
 }
 
 func (bup *BasicUpdatePlanner) ExecuteInsert(data *parser.InsertData, tx *tx.Transaction) (int, error) {
+	if err := checkWritable(data.Table); err != nil {
+		return 0, err
+	}
 	l, err := bup.Md.GetLayout(data.Table, tx)
 	if err != nil {
 		return 0, fmt.Errorf("ExecuteInsert GetLayout error: %v", err)
@@ -39,6 +42,9 @@ func (bup *BasicUpdatePlanner) ExecuteInsert(data *parser.InsertData, tx *tx.Tra
 func (bup *BasicUpdatePlanner) ExecuteDelete(data *parser.DeleteData, tx *tx.Transaction) (int, error) {
 	var affectedRows int
 
+	if err := checkWritable(data.Table); err != nil {
+		return 0, err
+	}
 	tp, err := NewTablePlan(data.Table, tx, bup.Md)
 	if err != nil {
 		return 0, fmt.Errorf("ExecuteDelete NewTablePlan error: %v", err)
@@ -61,6 +67,9 @@ func (bup *BasicUpdatePlanner) ExecuteDelete(data *parser.DeleteData, tx *tx.Tra
 func (bup *BasicUpdatePlanner) ExecuteModify(data *parser.UpdateData, tx *tx.Transaction) (int, error) {
 	var affectedRows int
 
+	if err := checkWritable(data.Table); err != nil {
+		return 0, err
+	}
 	tp, err := NewTablePlan(data.Table, tx, bup.Md)
 	if err != nil {
 		return 0, fmt.Errorf("ExecuteModify NewTablePlan error: %v", err)
@@ -83,6 +92,9 @@ func (bup *BasicUpdatePlanner) ExecuteModify(data *parser.UpdateData, tx *tx.Tra
 	return affectedRows, nil
 }
 func (bup *BasicUpdatePlanner) ExecuteCreateTable(data *parser.CreateTableData, tx *tx.Transaction) (int, error) {
+	if err := checkWritable(data.Table); err != nil {
+		return 0, err
+	}
 	return 0, bup.Md.CreateTable(data.Table, data.Schema, tx)
 }
 
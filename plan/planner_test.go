@@ -81,3 +81,63 @@ func TestPlanner(t *testing.T) {
 	assert.Equal(t, []int{2024, 2026}, gradyears)
 
 }
+
+func TestStatsTable(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "TestStatsTable")
+	_ = os.RemoveAll(tempDir) // Clean any previous test data
+
+	fm, err := file.NewFileMgr(tempDir, 256)
+	assert.NoError(t, err, "Failed to create FileMgr")
+	defer fm.Close()
+	lm, err := log.NewLogMgr(fm, "testlogfile")
+	assert.NoError(t, err, "Failed to create LogMgr")
+	bm := buffer.NewBufferMgr(fm, lm, 10)
+
+	tx1 := tx.NewTransaction(fm, lm, bm)
+	md := metadata.NewMetadataMgr(true, tx1)
+	planner := NewPlanner(NewBasicQueryPlan(md), NewBasicUpdatePlanner(md))
+
+	_, err = planner.ExecuteUpdate("create table student(sname varchar(30), gradyear int) ;", tx1)
+	assert.NoError(t, err, "Failed to ExecuteUpdate")
+	tx1.Commit()
+
+	stats := func(query string) map[string]int {
+		plan, err := planner.CreateQueryPlan(query, tx1)
+		assert.NoError(t, err, "Failed to CreateQueryPlan")
+		s, err := plan.Open()
+		assert.NoError(t, err, "Failed to Open")
+		defer s.Close()
+		values := make(map[string]int)
+		for s.Next() {
+			stat, err := s.GetString("stat")
+			assert.NoError(t, err)
+			filename, err := s.GetString("filename")
+			assert.NoError(t, err)
+			value, err := s.GetInt("value")
+			assert.NoError(t, err)
+			values[stat+filename] = value
+		}
+		return values
+	}
+
+	want := bm.Stats()
+	values := stats("select stat, filename, value from sys_stats")
+	assert.Equal(t, int(want.Pins), values["pins"])
+	assert.Equal(t, int(want.Hits), values["hits"])
+	assert.Equal(t, 10, values["buffers"])
+	assert.Equal(t, int(fm.Stats()["tblcat.tbl"].BlockWrites), values["block_writestblcat.tbl"])
+	assert.Greater(t, values["block_writestblcat.tbl"], 0)
+
+	values = stats("select stat, filename, value from sys_stats where stat = 'misses'")
+	assert.Equal(t, map[string]int{"misses": int(want.Misses)}, values)
+
+	bm.ResetStats()
+	fm.ResetStats()
+	values = stats("select stat, filename, value from sys_stats")
+	assert.Equal(t, 0, values["pins"])
+	assert.NotContains(t, values, "block_writestblcat.tbl")
+
+	_, err = planner.ExecuteUpdate("delete from sys_stats where stat = 'pins'", tx1)
+	assert.Error(t, err, "sys_stats should be read-only")
+	tx1.Commit()
+}
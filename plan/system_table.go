@@ -0,0 +1,166 @@
+package plan
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/CefBoud/CefDB/query"
+	"github.com/CefBoud/CefDB/record"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+// STATS_TABLE is the read-only system table holding the buffer pool and file I/O counters,
+// one row per counter, e.g. `select stat, value from sys_stats where stat = 'hits'`.
+// The per-file counters, block_reads and block_writes, have the file name in the filename column.
+const STATS_TABLE = "sys_stats"
+
+// StatsPlan is the plan of the stats system table.
+// The counters are read when the plan is opened.
+type StatsPlan struct {
+	Tx     *tx.Transaction
+	schema *record.Schema
+}
+
+func NewStatsPlan(tx *tx.Transaction) *StatsPlan {
+	sch := record.NewSchema()
+	sch.AddStringField("stat", 20)
+	sch.AddStringField("filename", 100)
+	sch.AddIntField("value")
+	return &StatsPlan{Tx: tx, schema: sch}
+}
+
+func (sp *StatsPlan) Open() (query.Scan, error) {
+	return &statsScan{rows: sp.rows(), current: -1}, nil
+}
+
+// rows returns the current counters as rows of the stats table.
+func (sp *StatsPlan) rows() []statsRow {
+	bs := sp.Tx.BufferMgr().Stats()
+	rows := []statsRow{
+		{"pins", "", int(bs.Pins)},
+		{"hits", "", int(bs.Hits)},
+		{"misses", "", int(bs.Misses)},
+		{"evictions", "", int(bs.Evictions)},
+		{"dirty_flushes", "", int(bs.DirtyFlushes)},
+		{"pin_waits", "", int(bs.PinWaits)},
+		{"pin_wait_us", "", int(bs.PinWaitTime.Microseconds())},
+		{"prefetches", "", int(bs.Prefetches)},
+		{"available", "", bs.Available},
+		{"buffers", "", bs.Buffers},
+	}
+	fs := sp.Tx.FileMgr().Stats()
+	filenames := make([]string, 0, len(fs))
+	for filename := range fs {
+		filenames = append(filenames, filename)
+	}
+	slices.Sort(filenames)
+	for _, filename := range filenames {
+		rows = append(rows,
+			statsRow{"block_reads", filename, int(fs[filename].BlockReads)},
+			statsRow{"block_writes", filename, int(fs[filename].BlockWrites)})
+	}
+	return rows
+}
+
+func (sp *StatsPlan) BlocksAccessed() int {
+	return 0
+}
+func (sp *StatsPlan) RecordsOutput() int {
+	return len(sp.rows())
+}
+func (sp *StatsPlan) DistinctValues(fldname string) int {
+	return sp.RecordsOutput()
+}
+func (sp *StatsPlan) Schema() *record.Schema {
+	return sp.schema
+}
+
+type statsRow struct {
+	stat     string
+	filename string
+	value    int
+}
+
+// statsScan scans the rows of the stats table.
+// It is an UpdateScan, so that it can be selected from, but the table can't be modified.
+type statsScan struct {
+	rows    []statsRow
+	current int
+}
+
+func (ss *statsScan) BeforeFirst() {
+	ss.current = -1
+}
+
+func (ss *statsScan) Next() bool {
+	ss.current++
+	return ss.current < len(ss.rows)
+}
+
+func (ss *statsScan) GetInt(fldname string) (int, error) {
+	if fldname != "value" {
+		return 0, fmt.Errorf("%v is not an int field of %v", fldname, STATS_TABLE)
+	}
+	return ss.rows[ss.current].value, nil
+}
+
+func (ss *statsScan) GetString(fldname string) (string, error) {
+	switch fldname {
+	case "stat":
+		return ss.rows[ss.current].stat, nil
+	case "filename":
+		return ss.rows[ss.current].filename, nil
+	}
+	return "", fmt.Errorf("%v is not a string field of %v", fldname, STATS_TABLE)
+}
+
+func (ss *statsScan) GetVal(fldname string) (any, error) {
+	if fldname == "value" {
+		return ss.GetInt(fldname)
+	}
+	return ss.GetString(fldname)
+}
+
+func (ss *statsScan) HasField(fldname string) bool {
+	return fldname == "stat" || fldname == "filename" || fldname == "value"
+}
+
+func (ss *statsScan) Close() {}
+
+func (ss *statsScan) SetVal(fldname string, val any) error {
+	return ss.readOnly()
+}
+func (ss *statsScan) SetInt(fldname string, val int) error {
+	return ss.readOnly()
+}
+func (ss *statsScan) SetString(fldname string, val string) error {
+	return ss.readOnly()
+}
+func (ss *statsScan) Insert() error {
+	return ss.readOnly()
+}
+func (ss *statsScan) Delete() error {
+	return ss.readOnly()
+}
+func (ss *statsScan) GetRid() record.RID {
+	return record.RID{BlkNum: 0, Slot: ss.current}
+}
+func (ss *statsScan) MoveToRID(rid record.RID) error {
+	if rid.Slot < 0 || rid.Slot >= len(ss.rows) {
+		return fmt.Errorf("no row %v in %v", rid, STATS_TABLE)
+	}
+	ss.current = rid.Slot
+	return nil
+}
+
+func (ss *statsScan) readOnly() error {
+	return checkWritable(STATS_TABLE)
+}
+
+// checkWritable returns an error if table is a system table.
+func checkWritable(table string) error {
+	if table == STATS_TABLE {
+		return fmt.Errorf("%v is read-only", table)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package record
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/CefBoud/CefDB/buffer"
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+const (
+	// HAS_ROOM marks a block that may have an empty slot.
+	// It is the value of blocks the map has no entry for yet.
+	HAS_ROOM = 0
+	// FULL marks a block whose slots were all found in use.
+	FULL = 1
+)
+
+// FreeSpaceMap records, for each block of a table file, whether it may have an empty slot.
+// It is stored in its own file holding one int per table block.
+// It is only a hint: its entries are read and written under a short latch,
+// without locks or logging, so that transactions updating different blocks of a table
+// don't wait for each other on the map. A block marked HAS_ROOM may turn out to be full,
+// and is then marked FULL by the insert that finds it full. A block is marked HAS_ROOM
+// again whenever one of its slots may have been emptied: by a delete, or by rollback
+// and recovery when they undo an insert or redo a delete.
+type FreeSpaceMap struct {
+	Tx       *tx.Transaction
+	Filename string
+}
+
+func init() {
+	tx.OnRestoredInt(restoredInt)
+}
+
+// restoredInt marks the block of a table HAS_ROOM when rollback or recovery wrote EMPTY in it.
+// The value may be a field rather than a slot flag, which only makes the entry a stale hint.
+func restoredInt(t *tx.Transaction, blk *file.BlockId, offset int, val int) error {
+	table, ok := strings.CutSuffix(blk.Filename, ".tbl")
+	if !ok || val != EMPTY {
+		return nil
+	}
+	return NewFreeSpaceMap(t, table).MarkHasRoom(blk.Blknum)
+}
+
+// fsmLatch serializes the accesses to the entries of the free-space maps.
+var fsmLatch sync.Mutex
+
+func NewFreeSpaceMap(tx *tx.Transaction, tableName string) *FreeSpaceMap {
+	return &FreeSpaceMap{Tx: tx, Filename: tableName + ".fsm"}
+}
+
+// entriesPerBlock returns the number of table blocks described by one map block.
+func (fsm *FreeSpaceMap) entriesPerBlock() int {
+	return fsm.Tx.BlockSize() / 4
+}
+
+// location returns the map block and offset of the entry for table block blknum.
+func (fsm *FreeSpaceMap) location(blknum int) (*file.BlockId, int) {
+	n := fsm.entriesPerBlock()
+	return file.NewBlockId(fsm.Filename, blknum/n), 4 * (blknum % n)
+}
+
+// size returns the number of blocks of the map file.
+func (fsm *FreeSpaceMap) size() (int, error) {
+	return fsm.Tx.FileMgr().Length(fsm.Filename)
+}
+
+// pin pins map block blk in a buffer of its own, outside of the transaction's buffers.
+func (fsm *FreeSpaceMap) pin(blk *file.BlockId) (*buffer.Buffer, error) {
+	bm := fsm.Tx.BufferMgr()
+	return bm.PinWithTimeout(blk, bm.PinTimeout())
+}
+
+// extend appends zeroed blocks to the map until it has block blk,
+// so that every new entry is HAS_ROOM.
+func (fsm *FreeSpaceMap) extend(blk *file.BlockId) error {
+	fsmLatch.Lock()
+	defer fsmLatch.Unlock()
+	size, err := fsm.size()
+	if err != nil {
+		return err
+	}
+	for ; size <= blk.Blknum; size++ {
+		if _, err := fsm.Tx.FileMgr().Append(fsm.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set changes the entry for table block blknum, extending the map if needed.
+func (fsm *FreeSpaceMap) set(blknum int, val int) error {
+	blk, offset := fsm.location(blknum)
+	size, err := fsm.size()
+	if err != nil {
+		return err
+	}
+	if blk.Blknum >= size {
+		if val == HAS_ROOM {
+			// blocks past the end of the map have no entry
+			return nil
+		}
+		if err := fsm.extend(blk); err != nil {
+			return err
+		}
+	}
+	buff, err := fsm.pin(blk)
+	if err != nil {
+		return err
+	}
+	defer fsm.Tx.BufferMgr().Unpin(buff)
+	fsmLatch.Lock()
+	defer fsmLatch.Unlock()
+	current, err := buff.Contents().GetInt(offset)
+	if err != nil || current == val {
+		return err
+	}
+	if err := buff.Contents().SetInt(offset, val); err != nil {
+		return err
+	}
+	// the change isn't logged; it is written with the pages of the transaction
+	buff.SetModified(fsm.Tx.TxNum(), -1)
+	return nil
+}
+
+// MarkFull records that table block blknum has no empty slot.
+func (fsm *FreeSpaceMap) MarkFull(blknum int) error {
+	if err := fsm.set(blknum, FULL); err != nil {
+		return fmt.Errorf("marking block %d of '%v' full: %w", blknum, fsm.Filename, err)
+	}
+	return nil
+}
+
+// MarkHasRoom records that table block blknum has an empty slot.
+func (fsm *FreeSpaceMap) MarkHasRoom(blknum int) error {
+	if err := fsm.set(blknum, HAS_ROOM); err != nil {
+		return fmt.Errorf("marking block %d of '%v' as having room: %w", blknum, fsm.Filename, err)
+	}
+	return nil
+}
+
+// FindBlockWithRoom returns the first table block at or after start, and before nblocks,
+// that may have an empty slot, or -1 if there is none.
+func (fsm *FreeSpaceMap) FindBlockWithRoom(start, nblocks int) (int, error) {
+	size, err := fsm.size()
+	if err != nil {
+		return -1, err
+	}
+	n := fsm.entriesPerBlock()
+	for blknum := start; blknum < nblocks; {
+		blk, _ := fsm.location(blknum)
+		if blk.Blknum >= size {
+			// blocks past the end of the map have no entry
+			return blknum, nil
+		}
+		buff, err := fsm.pin(blk)
+		if err != nil {
+			return -1, err
+		}
+		found, err := fsm.findInBlock(buff, blknum, nblocks)
+		fsm.Tx.BufferMgr().Unpin(buff)
+		if err != nil || found >= 0 {
+			return found, err
+		}
+		blknum = (blk.Blknum + 1) * n
+	}
+	return -1, nil
+}
+
+// findInBlock returns the first table block from blknum, and before nblocks,
+// whose entry in the pinned map block buff is HAS_ROOM, or -1 if there is none.
+func (fsm *FreeSpaceMap) findInBlock(buff *buffer.Buffer, blknum, nblocks int) (int, error) {
+	fsmLatch.Lock()
+	defer fsmLatch.Unlock()
+	n := fsm.entriesPerBlock()
+	for end := min(nblocks, (blknum/n+1)*n); blknum < end; blknum++ {
+		v, err := buff.Contents().GetInt(4 * (blknum % n))
+		if err != nil {
+			return -1, err
+		}
+		if v == HAS_ROOM {
+			return blknum, nil
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,148 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CefBoud/CefDB/buffer"
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeSpaceMap(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "TestFreeSpaceMap")
+	_ = os.RemoveAll(tempDir) // Clean any previous test data
+
+	fm, err := file.NewFileMgr(tempDir, 70)
+	assert.NoError(t, err, "Failed to create FileMgr")
+	defer fm.Close()
+	lm, err := log.NewLogMgr(fm, "testlogfile")
+	assert.NoError(t, err, "Failed to create LogMgr")
+	bm := buffer.NewBufferMgr(fm, lm, 3)
+
+	s := NewSchema()
+	s.AddIntField("A")
+	l := NewLayout(s) // 8-byte slots, 8 per block
+
+	// fill 5 blocks
+	tx1 := tx.NewTransaction(fm, lm, bm)
+	ts, err := NewTableScan(tx1, "T", l)
+	assert.NoError(t, err)
+	for i := 0; i < 40; i++ {
+		assert.NoError(t, ts.Insert())
+		assert.NoError(t, ts.SetInt("A", i))
+	}
+	ts.Close()
+	tx1.Commit()
+	size, _ := fm.Length("T.tbl")
+	assert.Equal(t, 5, size)
+
+	// free two slots of block 1
+	tx2 := tx.NewTransaction(fm, lm, bm)
+	ts, _ = NewTableScan(tx2, "T", l)
+	for ts.Next() {
+		if a, _ := ts.GetInt("A"); a == 9 || a == 10 {
+			assert.NoError(t, ts.Delete())
+		}
+	}
+	ts.Close()
+	tx2.Commit()
+
+	// the freed slots are reused instead of growing the file
+	tx3 := tx.NewTransaction(fm, lm, bm)
+	ts, _ = NewTableScan(tx3, "T", l)
+	ts.MoveToBlock(size - 1)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, ts.Insert())
+		assert.Equal(t, 1, ts.GetRid().BlkNum)
+		assert.NoError(t, ts.SetInt("A", 100+i))
+	}
+	ts.Close()
+	tx3.Commit()
+	size, _ = fm.Length("T.tbl")
+	assert.Equal(t, 5, size)
+
+	// a rolled back delete leaves a stale hint, corrected by the next insert
+	tx4 := tx.NewTransaction(fm, lm, bm)
+	ts, _ = NewTableScan(tx4, "T", l)
+	for ts.Next() {
+		if a, _ := ts.GetInt("A"); a == 20 {
+			assert.NoError(t, ts.Delete())
+		}
+	}
+	ts.Close()
+	tx4.Rollback()
+
+	tx5 := tx.NewTransaction(fm, lm, bm)
+	blknum, err := NewFreeSpaceMap(tx5, "T").FindBlockWithRoom(2, size)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, blknum)
+	ts, _ = NewTableScan(tx5, "T", l)
+	ts.MoveToBlock(3)
+	assert.NoError(t, ts.Insert()) // blocks 1 and 2 are found full on the way
+	assert.Equal(t, size, ts.GetRid().BlkNum)
+	ts.Close()
+	blknum, err = NewFreeSpaceMap(tx5, "T").FindBlockWithRoom(0, size)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, blknum)
+	tx5.Commit()
+
+	// rolled back inserts give their block room again
+	tx6 := tx.NewTransaction(fm, lm, bm)
+	ts, _ = NewTableScan(tx6, "T", l)
+	ts.MoveToBlock(size)
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, ts.Insert())
+	}
+	assert.Equal(t, size+1, ts.GetRid().BlkNum) // block 5 was found full
+	ts.Close()
+	assert.NoError(t, tx6.Rollback())
+
+	tx7 := tx.NewTransaction(fm, lm, bm)
+	blknum, err = NewFreeSpaceMap(tx7, "T").FindBlockWithRoom(0, size+2)
+	assert.NoError(t, err)
+	assert.Equal(t, size, blknum)
+	tx7.Commit()
+}
+
+func TestFreeSpaceMapConcurrentDeletes(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 70)
+	assert.NoError(t, err, "Failed to create FileMgr")
+	defer fm.Close()
+	lm, err := log.NewLogMgr(fm, "testlogfile")
+	assert.NoError(t, err, "Failed to create LogMgr")
+	bm := buffer.NewBufferMgr(fm, lm, 8)
+
+	s := NewSchema()
+	s.AddIntField("A")
+	l := NewLayout(s) // 8-byte slots, 8 per block
+
+	tx1 := tx.NewTransaction(fm, lm, bm)
+	ts, err := NewTableScan(tx1, "C", l)
+	assert.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		assert.NoError(t, ts.Insert())
+		assert.NoError(t, ts.SetInt("A", i))
+	}
+	ts.Close()
+	tx1.Commit()
+
+	// deletes in different blocks don't wait for each other on the free-space map
+	tx2 := tx.NewTransaction(fm, lm, bm)
+	tx3 := tx.NewTransaction(fm, lm, bm)
+	ts2, _ := NewTableScan(tx2, "C", l)
+	ts3, _ := NewTableScan(tx3, "C", l)
+	ts2.MoveToBlock(0)
+	assert.True(t, ts2.Next())
+	ts3.MoveToBlock(1)
+	assert.True(t, ts3.Next())
+	assert.NoError(t, ts2.Delete())
+	assert.NoError(t, ts3.Delete())
+	ts2.Close()
+	ts3.Close()
+	tx2.Commit()
+	tx3.Commit()
+}
@@ -3,6 +3,7 @@ package record
 import (
 	"fmt"
 
+	"github.com/CefBoud/CefDB/buffer"
 	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/tx"
 )
@@ -19,7 +20,12 @@ type RecordPage struct {
 }
 
 func NewRecordPage(tx *tx.Transaction, blk *file.BlockId, layout *Layout) (*RecordPage, error) {
-	err := tx.Pin(blk)
+	return newRecordPageInRing(tx, blk, layout, nil)
+}
+
+// newRecordPageInRing is NewRecordPage, reading the block into a buffer of ring if it isn't in the pool.
+func newRecordPageInRing(tx *tx.Transaction, blk *file.BlockId, layout *Layout, ring *buffer.Ring) (*RecordPage, error) {
+	err := tx.PinInRing(blk, ring)
 	if err != nil {
 		return nil, err
 	}
@@ -79,19 +85,20 @@ func (rp *RecordPage) Offset(slot int) int {
 	return rp.Layout.SlotSize * slot
 }
 
-// SearchAfter returns the next slot that comes after `slot` whose flag is `flag`
-func (rp *RecordPage) SearchAfter(slot, flag int) int {
+// SearchAfter returns the next slot that comes after `slot` whose flag is `flag`,
+// or -1 if there is none.
+func (rp *RecordPage) SearchAfter(slot, flag int) (int, error) {
 	slot++
 	for rp.IsValidSlot(slot) {
 		f, err := rp.Tx.GetInt(rp.Blk, rp.Offset(slot))
 		if err != nil {
-			return -1
+			return -1, fmt.Errorf("recordPage SearchAfter error: %w", err)
 		} else if f == flag {
-			return slot
+			return slot, nil
 		}
 		slot++
 	}
-	return -1
+	return -1, nil
 }
 
 func (rp *RecordPage) Format() error {
@@ -107,12 +114,17 @@ func (rp *RecordPage) Format() error {
 	return nil
 }
 
-func (rp *RecordPage) NextAfter(slot int) int {
+func (rp *RecordPage) NextAfter(slot int) (int, error) {
 	return rp.SearchAfter(slot, USED)
 }
 
+// InsertAfter claims the next empty slot after `slot` and returns it,
+// or -1 if there is none.
 func (rp *RecordPage) InsertAfter(slot int) (int, error) {
-	s := rp.SearchAfter(slot, EMPTY)
+	s, err := rp.SearchAfter(slot, EMPTY)
+	if err != nil {
+		return -1, err
+	}
 	if s > -1 {
 		err := rp.Tx.SetInt(rp.Blk, rp.Offset(s), USED, true)
 		if err != nil {
@@ -54,13 +54,13 @@ func TestRecordPage(t *testing.T) {
 		i++
 	}
 
-	slot = rp.NextAfter(-1)
+	slot, _ = rp.NextAfter(-1)
 	for slot > -1 {
 		i, _ = rp.GetInt(slot, "A")
 		if i%2 == 0 {
 			rp.Delete(slot)
 		}
-		slot = rp.NextAfter(slot)
+		slot, _ = rp.NextAfter(slot)
 	}
 
 	tx1.UnpinAll()
@@ -71,7 +71,7 @@ func TestRecordPage(t *testing.T) {
 
 	rp, _ = NewRecordPage(tx2, blk, l)
 
-	slot = rp.NextAfter(-1)
+	slot, _ = rp.NextAfter(-1)
 	var actuals_A []int
 	var actuals_B []string
 	for slot > -1 {
@@ -80,7 +80,7 @@ func TestRecordPage(t *testing.T) {
 		actuals_A = append(actuals_A, i)
 		s, _ := rp.GetString(slot, "B")
 		actuals_B = append(actuals_B, s)
-		slot = rp.NextAfter(slot)
+		slot, _ = rp.NextAfter(slot)
 	}
 	assert.Equal(t, []int{1, 3}, actuals_A)
 	assert.Equal(t, []string{"record1", "record3"}, actuals_B)
@@ -3,6 +3,7 @@ package record
 import (
 	"fmt"
 
+	"github.com/CefBoud/CefDB/buffer"
 	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/tx"
 )
@@ -18,12 +19,19 @@ type TableScan struct {
 	Filename          string
 	Layout            *Layout
 	CurrentRecordPage *RecordPage
+	FreeSpace         *FreeSpaceMap
 	currentSlot       int
+	appended          int          // blocks appended by the scan
+	ring              *buffer.Ring // buffers reused by a large scan, nil until the scan is large
 }
 
 func NewTableScan(tx *tx.Transaction, tableName string, l *Layout) (*TableScan, error) {
-	ts := &TableScan{Tx: tx, Filename: tableName + ".tbl", Layout: l}
+	ts := &TableScan{Tx: tx, Filename: tableName + ".tbl", Layout: l, FreeSpace: NewFreeSpaceMap(tx, tableName)}
 	size, _ := tx.Size(ts.Filename)
+	// scans of large tables start with a ring
+	if size > ts.largeScan() {
+		ts.ring = tx.BufferMgr().NewRing(buffer.RING_SIZE)
+	}
 	var err error
 	if size == 0 {
 		err = ts.MoveToNewBlock()
@@ -41,6 +49,11 @@ func (ts *TableScan) MoveToNewBlock() error {
 	if err != nil {
 		return err
 	}
+	// bulk loads get a ring once they are large
+	ts.appended++
+	if ts.ring == nil && ts.appended > ts.largeScan() {
+		ts.ring = ts.Tx.BufferMgr().NewRing(buffer.RING_SIZE)
+	}
 	err = ts.MoveToBlock(blk.Blknum)
 	if err != nil {
 		return err
@@ -48,10 +61,16 @@ func (ts *TableScan) MoveToNewBlock() error {
 	return ts.CurrentRecordPage.Format()
 }
 
+// largeScan returns the number of blocks above which a scan reads its blocks into
+// a ring of buffers, rather than evict the pages of the pool: a quarter of the pool.
+func (ts *TableScan) largeScan() int {
+	return ts.Tx.BufferMgr().Size() / 4
+}
+
 func (ts *TableScan) MoveToBlock(blknum int) error {
 	ts.Unpin()
 	var err error
-	ts.CurrentRecordPage, err = NewRecordPage(ts.Tx, &file.BlockId{Blknum: blknum, Filename: ts.Filename}, ts.Layout)
+	ts.CurrentRecordPage, err = newRecordPageInRing(ts.Tx, &file.BlockId{Blknum: blknum, Filename: ts.Filename}, ts.Layout, ts.ring)
 	ts.currentSlot = -1
 	return err
 }
@@ -60,41 +79,75 @@ func (ts *TableScan) BeforeFirst() {
 	ts.MoveToBlock(0)
 }
 
+// Next moves to the next record, and returns false if there is none
+// or the record can't be read.
 func (ts *TableScan) Next() bool {
-	ts.currentSlot = ts.CurrentRecordPage.NextAfter(ts.currentSlot)
-	for ts.currentSlot < 0 {
+	var err error
+	ts.currentSlot, err = ts.CurrentRecordPage.NextAfter(ts.currentSlot)
+	for err == nil && ts.currentSlot < 0 {
 		if ts.AtLastBlock() {
 			return false
 		}
 		ts.MoveToBlock(ts.CurrentRecordPage.Blk.Blknum + 1)
-		ts.currentSlot = ts.CurrentRecordPage.NextAfter(ts.currentSlot)
+		ts.currentSlot, err = ts.CurrentRecordPage.NextAfter(ts.currentSlot)
 	}
-	return true
+	return err == nil
 }
 
+// Insert inserts a new empty record and moves to it.
+// It prefers the current block, then the first block that the free-space map
+// says may have room, and appends a new block only if there is none.
 func (ts *TableScan) Insert() error {
-	var err error
-	ts.currentSlot, err = ts.CurrentRecordPage.InsertAfter(ts.currentSlot)
+	slot, err := ts.insertInCurrentBlock()
 	if err != nil {
 		return fmt.Errorf("TableScan Insert error: %v", err)
 	}
-	for ts.currentSlot < 0 {
-		if ts.AtLastBlock() {
-			ts.MoveToNewBlock()
+	for next := 0; slot < 0; {
+		size, err := ts.Tx.Size(ts.Filename)
+		if err != nil {
+			return fmt.Errorf("TableScan Insert error: %v", err)
+		}
+		blknum, err := ts.FreeSpace.FindBlockWithRoom(next, size)
+		if err != nil {
+			return fmt.Errorf("TableScan Insert error: %v", err)
+		}
+		if blknum < 0 {
+			err = ts.MoveToNewBlock()
 		} else {
-			ts.MoveToBlock(ts.CurrentRecordPage.Blk.Blknum + 1)
+			err = ts.MoveToBlock(blknum)
+			next = blknum + 1
 		}
-		ts.currentSlot, err = ts.CurrentRecordPage.InsertAfter(ts.currentSlot)
 		if err != nil {
 			return fmt.Errorf("TableScan Insert error: %v", err)
 		}
-
+		slot, err = ts.insertInCurrentBlock()
+		if err != nil {
+			return fmt.Errorf("TableScan Insert error: %v", err)
+		}
 	}
+	ts.currentSlot = slot
 	return nil
 }
 
+// insertInCurrentBlock claims an empty slot of the current block, looking after the
+// current slot first, and returns -1 after marking the block full if there is none.
+func (ts *TableScan) insertInCurrentBlock() (int, error) {
+	slot, err := ts.CurrentRecordPage.InsertAfter(ts.currentSlot)
+	if err == nil && slot < 0 && ts.currentSlot >= 0 {
+		slot, err = ts.CurrentRecordPage.InsertAfter(-1)
+	}
+	if err != nil || slot >= 0 {
+		return slot, err
+	}
+	return -1, ts.FreeSpace.MarkFull(ts.CurrentRecordPage.Blk.Blknum)
+}
+
+// Delete deletes the current record and records in the free-space map that its block has room.
 func (ts *TableScan) Delete() error {
-	return ts.CurrentRecordPage.Delete(ts.currentSlot)
+	if err := ts.CurrentRecordPage.Delete(ts.currentSlot); err != nil {
+		return err
+	}
+	return ts.FreeSpace.MarkHasRoom(ts.CurrentRecordPage.Blk.Blknum)
 }
 
 func (ts *TableScan) AtLastBlock() bool {
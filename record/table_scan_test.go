@@ -76,3 +76,62 @@ func TestTableScan(t *testing.T) {
 	assert.Equal(t, []string{"record1", "record3", "record5", "record7", "record9"}, actuals_B)
 
 }
+
+func TestTableScanRing(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	assert.NoError(t, err, "Failed to create FileMgr")
+	lm, err := log.NewLogMgr(fm, "testlogfiletx")
+	assert.NoError(t, err, "Failed to create LogMgr")
+	bm := buffer.NewBufferMgr(fm, lm, 16, buffer.WithReplacement(buffer.LRU))
+
+	hot := make([]*file.BlockId, 4)
+	pinHot := func() {
+		for i := range hot {
+			buff, err := bm.Pin(hot[i])
+			assert.NoError(t, err)
+			bm.Unpin(buff)
+		}
+	}
+	for i := range hot {
+		hot[i], err = fm.Append("hotfile")
+		assert.NoError(t, err)
+	}
+	pinHot()
+
+	s := NewSchema()
+	s.AddIntField("A")
+	s.AddStringField("B", 20)
+	l := NewLayout(s)
+
+	// the bulk load, and then the scan, of the large table leave the hot blocks in the pool
+	tx1 := tx.NewTransaction(fm, lm, bm)
+	ts, err := NewTableScan(tx1, "bigtable", l)
+	assert.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		assert.NoError(t, ts.Insert())
+		assert.NoError(t, ts.SetInt("A", i))
+		assert.NoError(t, ts.SetString("B", fmt.Sprintf("record%v", i)))
+	}
+	assert.NotNil(t, ts.ring, "bulk load should use a ring")
+	ts.Close()
+	tx1.Commit()
+	bm.ResetStats()
+	pinHot()
+	assert.Equal(t, int64(len(hot)), bm.Stats().Hits)
+
+	tx2 := tx.NewTransaction(fm, lm, bm)
+	ts, err = NewTableScan(tx2, "bigtable", l)
+	assert.NoError(t, err)
+	assert.NotNil(t, ts.ring, "scan of a large table should use a ring")
+	count := 0
+	for ts.Next() {
+		count++
+	}
+	ts.Close()
+	tx2.Commit()
+	assert.Equal(t, 200, count)
+
+	bm.ResetStats()
+	pinHot()
+	assert.Equal(t, int64(len(hot)), bm.Stats().Hits)
+}
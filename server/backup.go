@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// Backup copies the database to the directory dst, which must not exist or be empty,
+// while transactions keep running.
+// The data files are copied first and the log last, so that the log holds a record
+// of every change the copied files may contain. The copy may still miss changes,
+// or contain changes of uncommitted transactions: Restore fixes both using the log.
+func (db *CefDB) Backup(dst string) error {
+	storage, err := newEmptyStorage(dst)
+	if err != nil {
+		return err
+	}
+	files, err := db.fm.Files()
+	if err != nil {
+		return fmt.Errorf("listing database files: %w", err)
+	}
+	for _, filename := range files {
+		if db.lm.IsLogFile(filename) || strings.HasPrefix(filename, "temp") {
+			continue
+		}
+		if err := db.fm.CopyFile(filename, storage); err != nil {
+			return fmt.Errorf("backing up '%v': %w", filename, err)
+		}
+	}
+	if err := db.lm.CopyTo(storage); err != nil {
+		return fmt.Errorf("backing up log: %w", err)
+	}
+	return nil
+}
+
+// Restore copies the backup in src to the directory dirname, which must not exist or be empty,
+// and recovers it: changes of transactions that committed before the backup ended are redone
+// and the others are undone. The database must be restored with the same block size
+// and options it was created with.
+func Restore(src, dirname string, blockSize int, opts ...Option) error {
+	if _, err := copyBackup(src, dirname); err != nil {
+		return err
+	}
+	db, err := NewCefDB(dirname, blockSize, BUFFER_SIZE, opts...)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// copyBackup copies the files of the backup in src to the directory dirname,
+// which must not exist or be empty, and returns the storage of dirname.
+func copyBackup(src, dirname string) (*file.OSStorage, error) {
+	from, err := file.NewReadOnlyOSStorage(src)
+	if err != nil {
+		return nil, err
+	}
+	files, err := from.List()
+	if err != nil {
+		return nil, err
+	}
+	to, err := newEmptyStorage(dirname)
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range files {
+		if err := file.CopyStorageFile(from, to, filename); err != nil {
+			return nil, fmt.Errorf("restoring '%v': %w", filename, err)
+		}
+	}
+	return to, nil
+}
+
+// newEmptyStorage opens the directory dir, creating it if needed, and checks that it has no files.
+func newEmptyStorage(dir string) (*file.OSStorage, error) {
+	storage, err := file.NewOSStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return nil, fmt.Errorf("directory '%v' is not empty", dir)
+	}
+	return storage, nil
+}
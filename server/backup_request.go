@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// A backup request lets another process back up a database this process has open,
+// since the directory lock keeps it from opening the database itself.
+// The client sends the length of the backup directory path and the path, as seen
+// by the server. The server backs the database up there and answers with the length
+// of an error message and the message, of length 0 if the backup succeeded.
+const (
+	lengthBytes    = 4
+	maxStringBytes = 64 << 10
+)
+
+// ServeBackups backs up db for every client connecting through l and sending
+// a request with RequestBackup, until l is closed.
+func (db *CefDB) ServeBackups(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := db.serveBackup(conn); err != nil {
+				fmt.Printf("warning: backup requested by '%v' failed: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveBackup serves the backup request read from conn.
+func (db *CefDB) serveBackup(conn io.ReadWriter) error {
+	dst, err := readString(conn)
+	if err != nil {
+		return fmt.Errorf("reading backup request: %w", err)
+	}
+	backupErr := db.Backup(dst)
+	var msg string
+	if backupErr != nil {
+		msg = backupErr.Error()
+	}
+	if err := writeString(conn, msg); err != nil {
+		return errors.Join(backupErr, fmt.Errorf("answering backup request: %w", err))
+	}
+	return backupErr
+}
+
+// RequestBackup asks the process serving backups on conn to back up its database
+// to the directory dst, which must not exist or be empty, and waits until it is done.
+// dst is opened by the server, so a relative path is relative to its working directory.
+func RequestBackup(conn io.ReadWriter, dst string) error {
+	if err := writeString(conn, dst); err != nil {
+		return fmt.Errorf("sending backup request: %w", err)
+	}
+	msg, err := readString(conn)
+	if err != nil {
+		return fmt.Errorf("reading backup answer: %w", err)
+	}
+	if msg != "" {
+		return fmt.Errorf("backup failed: %v", msg)
+	}
+	return nil
+}
+
+func writeString(w io.Writer, s string) error {
+	b := make([]byte, lengthBytes, lengthBytes+len(s))
+	file.Encoding.PutUint32(b, uint32(len(s)))
+	_, err := w.Write(append(b, s...))
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	var header [lengthBytes]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", err
+	}
+	length := file.Encoding.Uint32(header[:])
+	if length > maxStringBytes {
+		return "", fmt.Errorf("string of %d bytes is too long", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
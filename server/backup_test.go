@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dbDir := filepath.Join(os.TempDir(), "TestBackup")
+	backupDir := filepath.Join(os.TempDir(), "TestBackupCopy")
+	restoreDir := filepath.Join(os.TempDir(), "TestBackupRestore")
+	for _, dir := range []string{dbDir, backupDir, restoreDir} {
+		_ = os.RemoveAll(dir) // Clean any previous test data
+	}
+
+	db, err := NewCefDB(dbDir, BLOCK_SIZE, 3)
+	assert.NoError(t, err)
+	blkA := file.NewBlockId("a.tbl", 0)
+	blkB := file.NewBlockId("b.tbl", 0)
+	db.FileMgr().Append(blkA.Filename)
+	db.FileMgr().Append(blkB.Filename)
+
+	// an uncommitted change that is on disk when the backup is taken
+	pending := db.NewTx()
+	blkC := file.NewBlockId("c.tbl", 0)
+	db.FileMgr().Append(blkC.Filename)
+	assert.NoError(t, pending.Pin(blkC))
+	assert.NoError(t, pending.SetInt(blkC, 0, 99, true))
+	pending.Unpin(blkC)
+	// pinning as many other blocks as there are buffers writes blkC to disk
+	other := db.NewTx()
+	for i := 0; i < 3; i++ {
+		blk, _ := other.Append("d.tbl")
+		other.Pin(blk)
+	}
+	other.Commit()
+
+	// writers keep the two counters of a.tbl and b.tbl equal in every transaction
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	increment := func() {
+		tx := db.NewTx()
+		tx.Pin(blkA)
+		tx.Pin(blkB)
+		a, _ := tx.GetInt(blkA, 0)
+		tx.SetInt(blkA, 0, a+1, true)
+		b, _ := tx.GetInt(blkB, 0)
+		tx.SetInt(blkB, 0, b+1, true)
+		tx.Commit()
+	}
+	increment()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			increment()
+		}
+	}()
+	assert.NoError(t, db.Backup(backupDir))
+	stop.Store(true)
+	wg.Wait()
+	pending.Rollback()
+	assert.NoError(t, db.Close())
+
+	assert.Error(t, db.Backup(backupDir), "backing up to a non-empty directory")
+
+	assert.NoError(t, Restore(backupDir, restoreDir, BLOCK_SIZE))
+	restored, err := NewCefDB(restoreDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	defer restored.Close()
+	tx := restored.NewTx()
+	tx.Pin(blkA)
+	tx.Pin(blkB)
+	tx.Pin(blkC)
+	a, _ := tx.GetInt(blkA, 0)
+	b, _ := tx.GetInt(blkB, 0)
+	c, _ := tx.GetInt(blkC, 0)
+	tx.Commit()
+	assert.GreaterOrEqual(t, a, 1)
+	assert.Equal(t, a, b, "counters of a consistent backup are equal")
+	assert.Equal(t, 0, c, "uncommitted change is undone")
+}
+
+func TestBackupRequest(t *testing.T) {
+	dbDir := filepath.Join(os.TempDir(), "TestBackupRequest")
+	backupDir := filepath.Join(os.TempDir(), "TestBackupRequestCopy")
+	restoreDir := filepath.Join(os.TempDir(), "TestBackupRequestRestore")
+	for _, dir := range []string{dbDir, backupDir, restoreDir} {
+		_ = os.RemoveAll(dir) // Clean any previous test data
+	}
+
+	db, err := NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	tx := db.NewTx()
+	blk, err := tx.Append("a.tbl")
+	assert.NoError(t, err)
+	tx.Pin(blk)
+	assert.NoError(t, tx.SetInt(blk, 0, 42, true))
+	tx.Commit()
+
+	// the running database can't be opened to be backed up, but serves backups
+	_, err = NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.ErrorIs(t, err, file.ErrLocked)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go db.ServeBackups(l)
+	request := func() error {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		return RequestBackup(conn, backupDir)
+	}
+	assert.NoError(t, request())
+	assert.ErrorContains(t, request(), "is not empty")
+	l.Close()
+	assert.NoError(t, db.Close())
+
+	assert.NoError(t, Restore(backupDir, restoreDir, BLOCK_SIZE))
+	restored, err := NewCefDB(restoreDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	defer restored.Close()
+	tx = restored.NewTx()
+	tx.Pin(blk)
+	val, err := tx.GetInt(blk, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, val)
+	tx.Commit()
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CefBoud/CefDB/buffer"
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+const (
+	BLOCK_SIZE  = 400
+	BUFFER_SIZE = 8
+	LOG_FILE    = "cefdb.log"
+)
+
+// The background writer of a database writes up to WRITER_BATCH dirty buffers every WRITER_INTERVAL.
+const (
+	WRITER_INTERVAL = 100 * time.Millisecond
+	WRITER_BATCH    = 2
+)
+
+// READ_AHEAD is the number of blocks read ahead of a sequential scan.
+const READ_AHEAD = 8
+
+// CefDB holds the managers of an open database.
+type CefDB struct {
+	fm     *file.FileMgr
+	lm     *log.LogMgr
+	bm     *buffer.BufferMgr
+	locks  *tx.LockTable
+	writer *buffer.BackgroundWriter // nil for a read-only database
+}
+
+// Option configures how a database is opened.
+type Option func(*options)
+
+type options struct {
+	file []file.Option
+	log  []log.Option
+}
+
+// WithFileOptions passes opts to the file manager of the database.
+func WithFileOptions(opts ...file.Option) Option {
+	return func(o *options) {
+		o.file = append(o.file, opts...)
+	}
+}
+
+// WithLogOptions passes opts to the log manager of the database, for instance
+// a retention policy releasing the log segments that recovery no longer needs.
+// A database must always be opened with the log segment size it was created with.
+func WithLogOptions(opts ...log.Option) Option {
+	return func(o *options) {
+		o.log = append(o.log, opts...)
+	}
+}
+
+// NewCefDB opens the database in dirname, creating it if needed.
+// An existing database is recovered before NewCefDB returns.
+func NewCefDB(dirname string, blockSize, bufferSize int, opts ...Option) (*CefDB, error) {
+	db, err := openCefDB(dirname, blockSize, bufferSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !db.fm.IsNew() && !db.fm.IsReadOnly() {
+		if err := db.recover(); err != nil {
+			return nil, errors.Join(fmt.Errorf("recovering database '%v': %w", dirname, err), db.Close())
+		}
+	}
+	return db, nil
+}
+
+// recover recovers the database in a transaction of its own.
+func (db *CefDB) recover() error {
+	tx := db.NewTx()
+	if err := tx.Recover(); err != nil {
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+// openCefDB opens the database in dirname without recovering it.
+func openCefDB(dirname string, blockSize, bufferSize int, opts ...Option) (*CefDB, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	fm, err := file.NewFileMgr(dirname, blockSize, o.file...)
+	if err != nil {
+		return nil, err
+	}
+	lm, err := log.NewLogMgr(fm, LOG_FILE, o.log...)
+	if err != nil {
+		return nil, errors.Join(err, fm.Close())
+	}
+	// read-only databases don't run transactions
+	if !fm.IsReadOnly() {
+		if err := tx.SeedTxNum(lm); err != nil {
+			return nil, errors.Join(err, fm.Close())
+		}
+	}
+	db := &CefDB{
+		fm:    fm,
+		lm:    lm,
+		bm:    buffer.NewBufferMgr(fm, lm, bufferSize, buffer.WithReadAhead(READ_AHEAD)),
+		locks: tx.NewLockTable(),
+	}
+	if !fm.IsReadOnly() {
+		db.writer = db.bm.StartBackgroundWriter(WRITER_INTERVAL, WRITER_BATCH)
+	}
+	return db, nil
+}
+
+// NewTx starts a new transaction.
+// A transaction can't pin more buffers at once than the pool holds:
+// it gets an error wrapping tx.ErrTooManyPins rather than wait for them in vain.
+func (db *CefDB) NewTx() *tx.Transaction {
+	t := tx.NewTransactionWithLocks(db.fm, db.lm, db.bm, db.locks)
+	t.SetMaxPins(db.bm.Size())
+	return t
+}
+
+func (db *CefDB) FileMgr() *file.FileMgr {
+	return db.fm
+}
+
+func (db *CefDB) LogMgr() *log.LogMgr {
+	return db.lm
+}
+
+func (db *CefDB) BufferMgr() *buffer.BufferMgr {
+	return db.bm
+}
+
+// Close stops the background writer, waits for the blocks being read ahead
+// and closes the database files.
+// Transactions must be completed first.
+func (db *CefDB) Close() error {
+	var err error
+	if db.writer != nil {
+		err = db.writer.Stop()
+		db.writer = nil
+	}
+	db.bm.WaitReadAhead()
+	return errors.Join(err, db.fm.Close())
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogOptions(t *testing.T) {
+	dbDir := filepath.Join(os.TempDir(), "TestLogOptions")
+	_ = os.RemoveAll(dbDir) // Clean any previous test data
+	opts := WithLogOptions(log.WithSegmentBlocks(2), log.WithRetention(log.DeleteSegments{}))
+	segments := func() int {
+		files, err := os.ReadDir(dbDir)
+		assert.NoError(t, err)
+		n := 0
+		for _, f := range files {
+			if log.IsSegment(LOG_FILE, f.Name()) {
+				n++
+			}
+		}
+		return n
+	}
+
+	db, err := NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE, opts)
+	assert.NoError(t, err)
+	tx := db.NewTx()
+	blk, err := tx.Append("a.tbl")
+	assert.NoError(t, err)
+	tx.Commit()
+	for i := 0; i < 50; i++ {
+		tx := db.NewTx()
+		tx.Pin(blk)
+		assert.NoError(t, tx.SetString(blk, 0, "a string long enough to fill the log quickly", true))
+		tx.Commit()
+	}
+	assert.NoError(t, db.Close())
+	before := segments()
+	assert.Greater(t, before, 2)
+
+	// recovery checkpoints the log, and the segments before the checkpoint are deleted
+	db, err = NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE, opts)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	assert.Less(t, segments(), before)
+}
+
+func TestLockTablePerDatabase(t *testing.T) {
+	var dbs []*CefDB
+	for _, name := range []string{"TestLockTablePrimary", "TestLockTableCopy"} {
+		dbDir := filepath.Join(os.TempDir(), name)
+		_ = os.RemoveAll(dbDir) // Clean any previous test data
+		db, err := NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE)
+		assert.NoError(t, err)
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+
+	// the end of the same file, then the same block, of two databases are locked by transactions of each
+	var txs []*tx.Transaction
+	for _, db := range dbs {
+		txn := db.NewTx()
+		blk, err := txn.Append("a.tbl")
+		assert.NoError(t, err)
+		assert.NoError(t, txn.Pin(blk))
+		assert.NoError(t, txn.SetInt(blk, 0, 1, true))
+		txs = append(txs, txn)
+	}
+	for _, txn := range txs {
+		txn.Commit()
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// SHIP_INTERVAL is how long the primary waits for new log records once a standby has caught up.
+// The primary sends a heartbeat each time, which carries its latest LSN.
+const SHIP_INTERVAL = 10 * time.Millisecond
+
+// A log shipping connection starts with the standby sending the LSN of the last record
+// in its log. The primary then sends frames holding the log records that follow, in order.
+// Each frame is made of the record's LSN, the primary's latest flushed LSN, the record length
+// and the record bytes. Heartbeat frames have a length of -1 and no record.
+const (
+	lsnBytes         = 8
+	frameHeaderBytes = 2*lsnBytes + 4
+)
+
+// ShipLog sends the log of db to the standby connected through conn, following the log
+// as it grows. It returns when a record can't be read or sent, for instance once
+// the standby closes the connection.
+func (db *CefDB) ShipLog(conn io.ReadWriter) error {
+	var hello [lsnBytes]byte
+	if _, err := io.ReadFull(conn, hello[:]); err != nil {
+		return fmt.Errorf("reading standby LSN: %w", err)
+	}
+	it, err := db.lm.ForwardIterator(int(file.Encoding.Uint64(hello[:])) + 1)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := it.NextRecord()
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			if err := writeFrame(conn, -1, db.lm.FlushedLSN(), nil); err != nil {
+				return err
+			}
+			time.Sleep(SHIP_INTERVAL)
+			continue
+		}
+		if err := writeFrame(conn, it.LSN(), db.lm.FlushedLSN(), rec); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeLog ships the log of db to every standby connecting through l,
+// until l is closed.
+func (db *CefDB) ServeLog(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := db.ShipLog(conn); err != nil {
+				fmt.Printf("warning: log shipping to '%v' stopped: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func writeFrame(w io.Writer, lsn int, primaryLSN int, rec []byte) error {
+	length := len(rec)
+	if rec == nil {
+		length = -1
+	}
+	frame := make([]byte, frameHeaderBytes, frameHeaderBytes+len(rec))
+	file.Encoding.PutUint64(frame, uint64(lsn))
+	file.Encoding.PutUint64(frame[lsnBytes:], uint64(primaryLSN))
+	file.Encoding.PutUint32(frame[2*lsnBytes:], uint32(length))
+	if _, err := w.Write(append(frame, rec...)); err != nil {
+		return fmt.Errorf("sending log record %d: %w", lsn, err)
+	}
+	return nil
+}
+
+// readFrame reads a frame written by writeFrame. rec is nil for a heartbeat.
+func readFrame(r io.Reader) (lsn int, primaryLSN int, rec []byte, err error) {
+	var header [frameHeaderBytes]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	lsn = int(int64(file.Encoding.Uint64(header[:])))
+	primaryLSN = int(int64(file.Encoding.Uint64(header[lsnBytes:])))
+	length := int32(file.Encoding.Uint32(header[2*lsnBytes:]))
+	if length < 0 {
+		return lsn, primaryLSN, nil, nil
+	}
+	rec = make([]byte, length)
+	if _, err := io.ReadFull(r, rec); err != nil {
+		return 0, 0, nil, fmt.Errorf("reading log record %d: %w", lsn, err)
+	}
+	return lsn, primaryLSN, rec, nil
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+// RecoveryTarget is the point in the log RestoreToPoint restores a database to.
+// Exactly one of its fields must be set.
+type RecoveryTarget struct {
+	LSN   int       // keep the records up to this LSN
+	TxNum int       // keep the records up to the COMMIT or ROLLBACK record of this transaction, which must be unique in the log
+	Time  time.Time // keep the transactions that committed at or before this time
+}
+
+func (t RecoveryTarget) String() string {
+	switch {
+	case t.LSN > 0:
+		return fmt.Sprintf("LSN %d", t.LSN)
+	case t.TxNum > 0:
+		return fmt.Sprintf("transaction %d", t.TxNum)
+	default:
+		return t.Time.Format(time.RFC3339Nano)
+	}
+}
+
+func (t RecoveryTarget) validate() error {
+	set := 0
+	for _, isSet := range []bool{t.LSN > 0, t.TxNum > 0, !t.Time.IsZero()} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("recovery target must have exactly one of an LSN, a transaction number or a time")
+	}
+	return nil
+}
+
+// RestoreToPoint restores the base backup in src to the directory dirname,
+// which must not exist or be empty, then replays the log up to target.
+// The log of the backup is completed with the log segments found in logDirs,
+// such as the archive of a retention policy or the directory of the damaged database;
+// when several directories hold a segment, the longest copy is used.
+// Transactions that committed after target are undone, like the incomplete ones,
+// so that a database can be restored to the moment before an operator mistake.
+func RestoreToPoint(src string, logDirs []string, dirname string, blockSize int, target RecoveryTarget, opts ...Option) error {
+	if err := target.validate(); err != nil {
+		return err
+	}
+	to, err := copyBackup(src, dirname)
+	if err != nil {
+		return err
+	}
+	for _, dir := range logDirs {
+		if err := copyLogSegments(dir, to); err != nil {
+			return fmt.Errorf("copying log segments from '%v': %w", dir, err)
+		}
+	}
+
+	db, err := openCefDB(dirname, blockSize, BUFFER_SIZE, opts...)
+	if err != nil {
+		return err
+	}
+	if err := db.recoverTo(target); err != nil {
+		return errors.Join(fmt.Errorf("recovering database '%v' to %v: %w", dirname, target, err), db.Close())
+	}
+	return db.Close()
+}
+
+// recoverTo truncates the log after target and recovers the database from the whole log.
+func (db *CefDB) recoverTo(target RecoveryTarget) error {
+	lsn, err := findRecoveryTarget(db.lm, target)
+	if err != nil {
+		return err
+	}
+	if err := db.lm.TruncateAfter(lsn); err != nil {
+		return err
+	}
+	tx := db.NewTx()
+	if err := tx.RecoverFromBase(); err != nil {
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+// findRecoveryTarget returns the LSN of the last log record to keep to restore the database to target.
+func findRecoveryTarget(lm *log.LogMgr, target RecoveryTarget) (int, error) {
+	it, err := lm.ForwardIterator(lm.FirstLSN())
+	if err != nil {
+		return -1, err
+	}
+	last := -1
+	completed := -1 // LSN of the COMMIT or ROLLBACK record of target.TxNum
+	for {
+		b, err := it.NextRecord()
+		if err != nil {
+			return -1, err
+		}
+		if b == nil {
+			break
+		}
+		r, err := tx.CreateLogRecord(b)
+		if err != nil {
+			return -1, fmt.Errorf("decoding log record at LSN %d: %w", it.LSN(), err)
+		}
+		lsn := it.LSN()
+		switch {
+		case target.LSN > 0:
+			if lsn > target.LSN {
+				return last, checkKept(last)
+			}
+		case target.TxNum > 0:
+			// transaction numbers may repeat across sessions in logs written
+			// before they were seeded from the log
+			if r.TxNumber() == target.TxNum && r.Op() == tx.START && completed >= 0 {
+				return -1, fmt.Errorf("transaction %d appears in several sessions of the log, restore to an LSN instead", target.TxNum)
+			}
+			if r.TxNumber() == target.TxNum && (r.Op() == tx.COMMIT || r.Op() == tx.ROLLBACK) {
+				completed = lsn
+			}
+		default:
+			if c, ok := r.(*tx.CommitRecord); ok && c.Time().After(target.Time) {
+				return last, checkKept(last)
+			}
+		}
+		last = lsn
+	}
+	if target.LSN > 0 && last == target.LSN {
+		return last, nil
+	}
+	if completed >= 0 {
+		return completed, nil
+	}
+	return -1, fmt.Errorf("the log ends at LSN %d, before the recovery target", last)
+}
+
+func checkKept(last int) error {
+	if last < 0 {
+		return fmt.Errorf("the recovery target precedes the log")
+	}
+	return nil
+}
+
+// copyLogSegments copies the log segments of the directory dir to dst,
+// unless dst already holds a copy that is at least as long.
+func copyLogSegments(dir string, dst *file.OSStorage) error {
+	from, err := file.NewReadOnlyOSStorage(dir)
+	if err != nil {
+		return err
+	}
+	files, err := from.List()
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		if !log.IsSegment(LOG_FILE, filename) {
+			continue
+		}
+		size, err := storageFileLength(from, filename)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			continue
+		}
+		existing, err := storageFileLength(dst, filename)
+		if err != nil {
+			return err
+		}
+		if existing >= size {
+			continue
+		}
+		if err := dst.Remove(filename); err != nil {
+			return err
+		}
+		if err := file.CopyStorageFile(from, dst, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func storageFileLength(s file.Storage, filename string) (int64, error) {
+	f, err := s.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Length()
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreToPoint(t *testing.T) {
+	dbDir := filepath.Join(os.TempDir(), "TestRestoreToPoint")
+	baseDir := filepath.Join(os.TempDir(), "TestRestoreToPointBase")
+	restoreDir := filepath.Join(os.TempDir(), "TestRestoreToPointCopy")
+	for _, dir := range []string{dbDir, baseDir, restoreDir} {
+		_ = os.RemoveAll(dir) // Clean any previous test data
+	}
+
+	db, err := NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	blk := file.NewBlockId("a.tbl", 0)
+	db.FileMgr().Append(blk.Filename)
+	type commit struct {
+		txnum int
+		lsn   int
+	}
+	// set commits the value of blk and returns the COMMIT record of the transaction
+	set := func(val int) commit {
+		tx1 := db.NewTx()
+		tx1.Pin(blk)
+		assert.NoError(t, tx1.SetInt(blk, 0, val, true))
+		tx1.Commit()
+		lsn := db.LogMgr().LatestLSN()
+		it, err := db.LogMgr().ForwardIterator(lsn)
+		assert.NoError(t, err)
+		b, err := it.NextRecord()
+		assert.NoError(t, err)
+		r, err := tx.CreateLogRecord(b)
+		assert.NoError(t, err)
+		assert.Equal(t, tx.COMMIT, r.Op())
+		return commit{r.TxNumber(), lsn}
+	}
+
+	set(1)
+	assert.NoError(t, db.Backup(baseDir))
+	set(2)
+	before3 := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	// a restart writes a checkpoint after the backup
+	assert.NoError(t, db.Close())
+	db, err = NewCefDB(dbDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	commit3 := set(3)
+	commit4 := set(4)
+	set(5) // the mistake
+	assert.NoError(t, db.Close())
+
+	restoredVal := func(target RecoveryTarget) int {
+		_ = os.RemoveAll(restoreDir)
+		assert.NoError(t, RestoreToPoint(baseDir, []string{dbDir}, restoreDir, BLOCK_SIZE, target))
+		restored, err := NewCefDB(restoreDir, BLOCK_SIZE, BUFFER_SIZE)
+		assert.NoError(t, err)
+		defer restored.Close()
+		p := file.NewPage(BLOCK_SIZE)
+		assert.NoError(t, restored.FileMgr().Read(blk, p))
+		v, _ := p.GetInt(0)
+		return v
+	}
+	assert.Equal(t, 2, restoredVal(RecoveryTarget{Time: before3}))
+	assert.Equal(t, 3, restoredVal(RecoveryTarget{LSN: commit3.lsn}))
+	assert.Equal(t, 3, restoredVal(RecoveryTarget{LSN: commit4.lsn - 1})) // commit 4 is undone
+	assert.Equal(t, 4, restoredVal(RecoveryTarget{TxNum: commit4.txnum}))
+
+	_ = os.RemoveAll(restoreDir)
+	err = RestoreToPoint(baseDir, nil, restoreDir, BLOCK_SIZE, RecoveryTarget{TxNum: commit4.txnum})
+	assert.ErrorContains(t, err, "before the recovery target")
+	_ = os.RemoveAll(restoreDir)
+	err = RestoreToPoint(baseDir, nil, restoreDir, BLOCK_SIZE, RecoveryTarget{LSN: 1, TxNum: 1})
+	assert.ErrorContains(t, err, "exactly one")
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/tx"
+)
+
+// ErrPromoted is returned when replicating to a standby that was promoted to primary.
+var ErrPromoted = errors.New("standby was promoted")
+
+// Standby is a copy of a database that replays the log shipped by its primary.
+//
+// A standby starts from a backup of the primary. Shipped records are appended to
+// its own log, where they get the same LSNs as in the primary's log,
+// and the changes of a transaction are replayed once its COMMIT record arrives,
+// or undone if its ROLLBACK record arrives, so that the data files only ever
+// hold the changes the primary's recovery would keep.
+// The standby can't run transactions until it is promoted.
+type Standby struct {
+	db          *CefDB
+	pending     map[int][]tx.LogRecord // changes of the transactions that didn't complete yet
+	replayedLSN int
+	primaryLSN  int
+	lastContact time.Time
+	conn        io.ReadWriteCloser // the connection Replicate is reading from, if any
+	replicating sync.WaitGroup
+	promoted    bool
+	sync.Mutex
+}
+
+// ReplicationLag describes how far a standby is behind its primary.
+type ReplicationLag struct {
+	PrimaryLSN  int       // latest flushed LSN reported by the primary
+	ReplayedLSN int       // LSN of the last record received by the standby
+	LastContact time.Time // when the primary was last heard from, zero if never
+}
+
+// Bytes returns the number of log bytes the standby has yet to receive.
+func (l ReplicationLag) Bytes() int {
+	return max(l.PrimaryLSN-l.ReplayedLSN, 0)
+}
+
+// OpenStandby opens the standby database in dirname, typically created by Backup.
+// The standby isn't recovered: the changes of the transactions its log holds are
+// replayed or undone as they complete, and those of the others are kept aside
+// until the primary ships their outcome.
+func OpenStandby(dirname string, blockSize, bufferSize int, opts ...Option) (*Standby, error) {
+	db, err := openCefDB(dirname, blockSize, bufferSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Standby{db: db, pending: make(map[int][]tx.LogRecord)}
+	if err := s.replayLog(); err != nil {
+		return nil, errors.Join(fmt.Errorf("replaying standby log: %w", err), db.Close())
+	}
+	s.replayedLSN = db.lm.LatestLSN()
+	s.primaryLSN = s.replayedLSN
+	return s, nil
+}
+
+// replayLog replays the records already in the standby's log.
+func (s *Standby) replayLog() error {
+	it, err := s.db.lm.ForwardIterator(s.db.lm.FirstLSN())
+	if err != nil {
+		return err
+	}
+	for {
+		b, err := it.NextRecord()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return nil
+		}
+		if err := s.replay(it.LSN(), b); err != nil {
+			return err
+		}
+	}
+}
+
+// Replicate receives the log of the primary through conn, as sent by ShipLog,
+// and replays it until conn is closed or Promote is called.
+// Returns nil once the connection is closed by either side.
+func (s *Standby) Replicate(conn io.ReadWriteCloser) error {
+	s.Lock()
+	if s.promoted {
+		s.Unlock()
+		return ErrPromoted
+	}
+	if s.conn != nil {
+		s.Unlock()
+		return fmt.Errorf("standby is already replicating")
+	}
+	s.conn = conn
+	s.replicating.Add(1)
+	lsn := s.db.lm.LatestLSN()
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		s.conn = nil
+		s.Unlock()
+		s.replicating.Done()
+	}()
+
+	var hello [lsnBytes]byte
+	file.Encoding.PutUint64(hello[:], uint64(lsn))
+	if _, err := conn.Write(hello[:]); err != nil {
+		return fmt.Errorf("sending standby LSN: %w", err)
+	}
+	for {
+		lsn, primaryLSN, rec, err := readFrame(conn)
+		if err != nil {
+			if s.isPromoted() {
+				return ErrPromoted
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if err := s.receive(lsn, primaryLSN, rec); err != nil {
+			return err
+		}
+	}
+}
+
+// receive appends a shipped record to the standby log and replays it.
+// rec is nil for a heartbeat.
+func (s *Standby) receive(lsn int, primaryLSN int, rec []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.promoted {
+		return ErrPromoted
+	}
+	s.primaryLSN = primaryLSN
+	s.lastContact = time.Now()
+	if rec == nil {
+		return nil
+	}
+	appended, err := s.db.lm.Append(rec)
+	if err != nil {
+		return err
+	}
+	if appended != lsn {
+		return fmt.Errorf("standby log diverged from the primary: record %d was appended at LSN %d", lsn, appended)
+	}
+	if err := s.replay(lsn, rec); err != nil {
+		return fmt.Errorf("replaying log record %d: %w", lsn, err)
+	}
+	s.replayedLSN = lsn
+	return nil
+}
+
+// replay applies the log record at lsn to the data files.
+func (s *Standby) replay(lsn int, b []byte) error {
+	r, err := tx.CreateLogRecord(b)
+	if err != nil {
+		return err
+	}
+	switch r.Op() {
+	case tx.SETINT, tx.SETSTRING:
+		s.pending[r.TxNumber()] = append(s.pending[r.TxNumber()], r)
+		return nil
+	case tx.COMMIT:
+		return s.complete(r.TxNumber(), lsn, false)
+	case tx.ROLLBACK:
+		return s.complete(r.TxNumber(), lsn, true)
+	case tx.CHECKPOINT:
+		// the primary was recovered: the transactions that didn't complete were undone
+		for txnum := range s.pending {
+			if err := s.complete(txnum, lsn, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// complete redoes, or undoes, the changes of transaction txnum, which completed at lsn,
+// and makes them durable.
+func (s *Standby) complete(txnum int, lsn int, undo bool) error {
+	changes := s.pending[txnum]
+	delete(s.pending, txnum)
+	if undo {
+		changes = slices.Clone(changes)
+		slices.Reverse(changes)
+	}
+	for _, r := range changes {
+		if err := s.write(txnum, lsn, r, undo); err != nil {
+			return err
+		}
+	}
+	if err := s.db.bm.FlushAll(txnum); err != nil {
+		return err
+	}
+	return s.db.lm.Flush(lsn)
+}
+
+// write sets the new value of a SETINT or SETSTRING record, or its old value if undo is true.
+func (s *Standby) write(txnum int, lsn int, r tx.LogRecord, undo bool) error {
+	var blk *file.BlockId
+	var set func(p *file.Page) error
+	switch r := r.(type) {
+	case *tx.SetIntRecord:
+		blk = r.Block()
+		val := r.NewVal()
+		if undo {
+			val = r.OldVal()
+		}
+		set = func(p *file.Page) error { return p.SetInt(r.Offset(), val) }
+	case *tx.SetStringRecord:
+		blk = r.Block()
+		val := r.NewVal()
+		if undo {
+			val = r.OldVal()
+		}
+		set = func(p *file.Page) error { return p.SetString(r.Offset(), val) }
+	default:
+		return nil
+	}
+	if err := s.extendTo(blk); err != nil {
+		return err
+	}
+	buff, err := s.db.bm.Pin(blk)
+	if err != nil {
+		return fmt.Errorf("replaying %v: %w", r, err)
+	}
+	defer s.db.bm.Unpin(buff)
+	if err := set(buff.Contents()); err != nil {
+		return fmt.Errorf("replaying %v: %w", r, err)
+	}
+	buff.SetModified(txnum, lsn)
+	return nil
+}
+
+// extendTo appends blocks to the file of blk until blk exists,
+// since the primary may have appended it after the standby was created.
+func (s *Standby) extendTo(blk *file.BlockId) error {
+	size, err := s.db.fm.Length(blk.Filename)
+	if err != nil {
+		return err
+	}
+	for ; size <= blk.Blknum; size++ {
+		if _, err := s.db.fm.Append(blk.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lag returns how far the standby is behind its primary.
+func (s *Standby) Lag() ReplicationLag {
+	s.Lock()
+	defer s.Unlock()
+	return ReplicationLag{PrimaryLSN: s.primaryLSN, ReplayedLSN: s.replayedLSN, LastContact: s.lastContact}
+}
+
+func (s *Standby) isPromoted() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.promoted
+}
+
+// Promote stops the replication, closing the connection to the primary,
+// and recovers the standby so that it can run transactions as the new primary.
+// The changes of the transactions whose outcome wasn't shipped are undone.
+func (s *Standby) Promote() (*CefDB, error) {
+	s.Lock()
+	if s.promoted {
+		s.Unlock()
+		return nil, ErrPromoted
+	}
+	s.promoted = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.Unlock()
+	s.replicating.Wait()
+
+	if err := s.db.recover(); err != nil {
+		return nil, fmt.Errorf("recovering promoted standby: %w", err)
+	}
+	return s.db, nil
+}
+
+// Close closes the standby database files. Once promoted, the database is closed through CefDB.Close.
+func (s *Standby) Close() error {
+	s.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.Unlock()
+	s.replicating.Wait()
+	return s.db.Close()
+}
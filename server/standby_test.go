@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandby(t *testing.T) {
+	primaryDir := filepath.Join(os.TempDir(), "TestStandbyPrimary")
+	standbyDir := filepath.Join(os.TempDir(), "TestStandby")
+	socket := filepath.Join(os.TempDir(), "TestStandby.sock")
+	for _, path := range []string{primaryDir, standbyDir, socket} {
+		_ = os.RemoveAll(path) // Clean any previous test data
+	}
+
+	primary, err := NewCefDB(primaryDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	defer primary.Close()
+	setInt := func(filename string, val int, commit bool) {
+		tx := primary.NewTx()
+		blk, err := tx.Append(filename)
+		assert.NoError(t, err)
+		tx.Pin(blk)
+		assert.NoError(t, tx.SetInt(blk, 0, val, true))
+		if commit {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	setInt("a.tbl", 1, true)
+
+	// an uncommitted change is in the backup the standby starts from
+	pending := primary.NewTx()
+	blkB := file.NewBlockId("b.tbl", 0)
+	primary.FileMgr().Append(blkB.Filename)
+	assert.NoError(t, pending.Pin(blkB))
+	assert.NoError(t, pending.SetInt(blkB, 0, 99, true))
+	assert.NoError(t, pending.SetString(blkB, 8, "uncommitted", true))
+	assert.NoError(t, primary.LogMgr().Flush(primary.LogMgr().LatestLSN()))
+	assert.NoError(t, primary.Backup(standbyDir))
+
+	standby, err := OpenStandby(standbyDir, BLOCK_SIZE, BUFFER_SIZE)
+	assert.NoError(t, err)
+	l, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	defer l.Close()
+	go primary.ServeLog(l)
+	conn, err := net.Dial("unix", socket)
+	assert.NoError(t, err)
+	replicated := make(chan error, 1)
+	go func() { replicated <- standby.Replicate(conn) }()
+
+	setInt("c.tbl", 3, true)
+	setInt("d.tbl", 4, false)
+	for i := 0; i < 20; i++ {
+		setInt("e.tbl", i, true)
+	}
+	latest := primary.LogMgr().FlushedLSN()
+	deadline := time.Now().Add(5 * time.Second)
+	for lag := standby.Lag(); lag.ReplayedLSN < latest || lag.Bytes() > 0; lag = standby.Lag() {
+		if time.Now().After(deadline) {
+			t.Fatalf("standby didn't catch up with the primary: %+v, latest LSN %d", lag, latest)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, standby.Lag().LastContact.IsZero())
+
+	// the primary fails before the pending transaction completes
+	conn.Close()
+	assert.NoError(t, <-replicated)
+	pending.Rollback()
+	promoted, err := standby.Promote()
+	assert.NoError(t, err)
+	defer promoted.Close()
+	_, err = standby.Promote()
+	assert.ErrorIs(t, err, ErrPromoted)
+
+	getInt := func(filename string, blknum int) int {
+		p := file.NewPage(BLOCK_SIZE)
+		assert.NoError(t, promoted.FileMgr().Read(file.NewBlockId(filename, blknum), p))
+		v, _ := p.GetInt(0)
+		return v
+	}
+	assert.Equal(t, 1, getInt("a.tbl", 0))
+	assert.Equal(t, 0, getInt("b.tbl", 0))
+	assert.Equal(t, 3, getInt("c.tbl", 0))
+	assert.Equal(t, 0, getInt("d.tbl", 0))
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, i, getInt("e.tbl", i))
+	}
+
+	// the promoted standby runs transactions
+	tx := promoted.NewTx()
+	blk, err := tx.Append("f.tbl")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Pin(blk))
+	assert.NoError(t, tx.SetInt(blk, 0, 6, true))
+	tx.Commit()
+	assert.Equal(t, 6, getInt("f.tbl", 0))
+}
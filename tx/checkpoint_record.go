@@ -1,14 +1,26 @@
 package tx
 
 import (
-	"github.com/CefBoud/CefDB/file"
+	"fmt"
+
 	"github.com/CefBoud/CefDB/log"
 )
 
-type CheckpointRecord struct{}
+type CheckpointRecord struct {
+	lastTxNum int
+}
 
-func NewCheckpointRecord(b []byte) *CheckpointRecord {
-	return &CheckpointRecord{}
+func NewCheckpointRecord(b []byte) (*CheckpointRecord, error) {
+	r := newRecordReader(b)
+	var lastTxNum int
+	// records written before transaction numbers were logged are empty
+	if r.more() {
+		lastTxNum = r.int()
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding CHECKPOINT record: %w", r.err)
+	}
+	return &CheckpointRecord{lastTxNum: lastTxNum}, nil
 }
 
 func (r *CheckpointRecord) String() string {
@@ -23,12 +35,20 @@ func (cr *CheckpointRecord) TxNumber() int {
 	return -1
 }
 
-func (cr *CheckpointRecord) Undo(tx Transaction) {}
+// LastTxNum returns the last transaction number handed out when the checkpoint was written,
+// or 0 for records that don't hold it.
+func (cr *CheckpointRecord) LastTxNum() int {
+	return cr.lastTxNum
+}
+
+func (cr *CheckpointRecord) Undo(tx Transaction) error { return nil }
+
+func (cr *CheckpointRecord) Redo(tx Transaction) error { return nil }
 
-// WriteCheckpointRecordToLog appends a CHECKPOINT record to the log and return the LSN and error
-func WriteCheckpointRecordToLog(lm *log.LogMgr) (int, error) {
-	b := make([]byte, 4)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, CHECKPOINT)
-	return lm.Append(p.Contents())
+// WriteCheckpointRecordToLog appends a CHECKPOINT record, holding the last transaction number
+// handed out, to the log and return the LSN and error
+func WriteCheckpointRecordToLog(lm *log.LogMgr, lastTxNum int) (int, error) {
+	w := newRecordWriter(CHECKPOINT, 4)
+	w.int(lastTxNum)
+	return w.appendTo(lm)
 }
@@ -2,20 +2,31 @@ package tx
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/log"
 )
 
 type CommitRecord struct {
 	txNum int
+	time  time.Time
 }
 
-func NewCommitRecord(b []byte) *CommitRecord {
-	p := file.NewPageFromBytes(b)
-	return &CommitRecord{
-		txNum: p.GetInt(4),
+func NewCommitRecord(b []byte) (*CommitRecord, error) {
+	r := newRecordReader(b)
+	txNum := r.int()
+	var t time.Time
+	// records written before commit times were logged end with the transaction number
+	if r.more() {
+		t = time.Unix(0, r.int64())
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding COMMIT record: %w", r.err)
 	}
+	return &CommitRecord{
+		txNum: txNum,
+		time:  t,
+	}, nil
 }
 func (r *CommitRecord) String() string {
 	return fmt.Sprintf(
@@ -32,13 +43,19 @@ func (cr *CommitRecord) TxNumber() int {
 	return cr.txNum
 }
 
-func (cr *CommitRecord) Undo(tx Transaction) {}
+// Time returns when the transaction committed, or the zero time for records that don't hold it.
+func (cr *CommitRecord) Time() time.Time {
+	return cr.time
+}
+
+func (cr *CommitRecord) Undo(tx Transaction) error { return nil }
+
+func (cr *CommitRecord) Redo(tx Transaction) error { return nil }
 
-// WriteCommitRecordToLog appends a commit record to the log and return the LSN and error
+// WriteCommitRecordToLog appends a commit record, stamped with the current time, to the log and return the LSN and error
 func WriteCommitRecordToLog(lm *log.LogMgr, txnum int) (int, error) {
-	b := make([]byte, 8)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, COMMIT)
-	p.SetInt(4, txnum)
-	return lm.Append(p.Contents())
+	w := newRecordWriter(COMMIT, 4+8)
+	w.int(txnum)
+	w.int64(time.Now().UnixNano())
+	return w.appendTo(lm)
 }
@@ -1,79 +1,67 @@
 package tx
 
 import (
-	"sync"
 	"time"
 
 	"github.com/CefBoud/CefDB/file"
-	"github.com/viney-shih/go-lock"
 )
 
-// global lock map storing blockId => *sync.RWMutex{}
-// very important to store pointers as mutex must not be copied
-var globalLockMap sync.Map
-
 const (
 	MAX_TIME = 5 * time.Second
 	S_LOCK   = 1 // read shared lock
 	X_LOCK   = 2 // write exclusive lock
 )
 
+// ConcurrencyMgr holds the locks of a transaction, which are granted by the lock table of its database.
 type ConcurrencyMgr struct {
 	CurrentLocks map[file.BlockId]int
+	txnum        int
+	locks        *LockTable
 }
 
-func NewConcurrencyMgr() *ConcurrencyMgr {
+func NewConcurrencyMgr(txnum int, locks *LockTable) *ConcurrencyMgr {
 	return &ConcurrencyMgr{
 		CurrentLocks: make(map[file.BlockId]int),
+		txnum:        txnum,
+		locks:        locks,
 	}
 }
 
-func (cm *ConcurrencyMgr) SLock(blk *file.BlockId) bool {
+// SLock obtains a shared lock on blk, unless the transaction already holds a lock on it.
+// Returns an error wrapping ErrDeadlock or ErrLockTimeout if the lock can't be granted.
+func (cm *ConcurrencyMgr) SLock(blk *file.BlockId) error {
 	// if we already have a lock (S or X), we return
 	if _, ok := cm.CurrentLocks[*blk]; ok {
-		return ok
+		return nil
 	}
-
-	v, _ := globalLockMap.LoadOrStore(*blk, lock.NewCASMutex())
-	l := v.(*lock.CASMutex)
-	ok := l.RTryLockWithTimeout(MAX_TIME)
-	if ok {
-		cm.CurrentLocks[*blk] = S_LOCK
+	if err := cm.locks.acquire(cm.txnum, *blk, S_LOCK); err != nil {
+		return err
 	}
-	return ok
+	cm.CurrentLocks[*blk] = S_LOCK
+	return nil
 }
 
-func (cm *ConcurrencyMgr) XLock(blk *file.BlockId) bool {
-
-	if v, ok := cm.CurrentLocks[*blk]; ok {
-		// if we already have a X_LOCK, we return early
-		if v == X_LOCK {
-			return ok
-		}
-		// we have a S_LOCK, we release it to upgrade to an X_LOCK
-		cm.SUnlock(blk)
+// XLock obtains an exclusive lock on blk, upgrading the shared lock the transaction may hold.
+// Returns an error wrapping ErrDeadlock or ErrLockTimeout if the lock can't be granted.
+func (cm *ConcurrencyMgr) XLock(blk *file.BlockId) error {
+	// if we already have a X_LOCK, we return early
+	if cm.CurrentLocks[*blk] == X_LOCK {
+		return nil
 	}
-
-	v, _ := globalLockMap.LoadOrStore(*blk, lock.NewCASMutex())
-	l := v.(*lock.CASMutex)
-	ok := l.TryLockWithTimeout(MAX_TIME)
-	if ok {
-		cm.CurrentLocks[*blk] = X_LOCK
+	if err := cm.locks.acquire(cm.txnum, *blk, X_LOCK); err != nil {
+		return err
 	}
-	return ok
+	cm.CurrentLocks[*blk] = X_LOCK
+	return nil
 }
 
 func (cm *ConcurrencyMgr) SUnlock(blk *file.BlockId) {
-	v, _ := globalLockMap.LoadOrStore(*blk, lock.NewCASMutex())
-	l := v.(*lock.CASMutex)
-	l.RUnlock()
+	cm.locks.release(cm.txnum, *blk)
 	delete(cm.CurrentLocks, *blk)
 }
 
 func (cm *ConcurrencyMgr) XUnlock(blk *file.BlockId) {
-	v, _ := globalLockMap.LoadOrStore(*blk, lock.NewCASMutex())
-	l := v.(*lock.CASMutex)
-	l.Unlock()
+	cm.locks.release(cm.txnum, *blk)
 	delete(cm.CurrentLocks, *blk)
 }
 
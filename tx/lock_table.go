@@ -0,0 +1,215 @@
+package tx
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CefBoud/CefDB/file"
+)
+
+// ErrDeadlock is returned when a lock request would complete a cycle of transactions
+// waiting for each other. The youngest transaction of the cycle is chosen as the victim:
+// it should be rolled back, and can be retried.
+var ErrDeadlock = errors.New("deadlock detected")
+
+// ErrLockTimeout is returned when a lock wasn't granted in time, although the
+// transactions holding it aren't waiting for the requester.
+var ErrLockTimeout = errors.New("lock wait timed out")
+
+// LockTable grants the block locks of the transactions of a database.
+// Block ids only name a block within a database: the databases opened
+// by a process each need a lock table of their own.
+// It records the lock each blocked transaction waits for, so that the wait-for graph
+// can be checked for a cycle whenever a transaction starts waiting.
+type LockTable struct {
+	locks   map[file.BlockId]*blockLock
+	waiting map[int]*lockWait // lock request of each waiting transaction
+	timeout time.Duration
+	sync.Mutex
+}
+
+// blockLock is the state of the lock of a block.
+type blockLock struct {
+	sharers  map[int]bool  // transactions holding an S_LOCK
+	writer   int           // transaction holding the X_LOCK, 0 if none
+	released chan struct{} // closed, and replaced, when the lock is released
+}
+
+type lockWait struct {
+	blk   file.BlockId
+	mode  int
+	abort chan struct{} // closed when the transaction is chosen as a deadlock victim
+}
+
+// the lock table of the transactions created by NewTransaction
+var locks = NewLockTable()
+
+// NewLockTable creates a lock table whose requests wait up to MAX_TIME for a lock.
+func NewLockTable() *LockTable {
+	return newLockTable(MAX_TIME)
+}
+
+func newLockTable(timeout time.Duration) *LockTable {
+	return &LockTable{
+		locks:   make(map[file.BlockId]*blockLock),
+		waiting: make(map[int]*lockWait),
+		timeout: timeout,
+	}
+}
+
+func (lt *LockTable) lock(blk file.BlockId) *blockLock {
+	l, ok := lt.locks[blk]
+	if !ok {
+		l = &blockLock{sharers: make(map[int]bool), released: make(chan struct{})}
+		lt.locks[blk] = l
+	}
+	return l
+}
+
+// blockers returns the transactions, other than txnum, whose hold on l prevents
+// granting it to txnum in mode.
+func (l *blockLock) blockers(txnum int, mode int) []int {
+	var txnums []int
+	if l.writer != 0 && l.writer != txnum {
+		txnums = append(txnums, l.writer)
+	}
+	if mode == X_LOCK {
+		for sharer := range l.sharers {
+			if sharer != txnum {
+				txnums = append(txnums, sharer)
+			}
+		}
+	}
+	return txnums
+}
+
+// acquire grants the lock of blk in mode to txnum, waiting for the transactions holding it.
+// A transaction holding an S_LOCK can request the X_LOCK: it keeps its S_LOCK while it waits.
+// Returns an error wrapping ErrDeadlock if txnum is chosen as a deadlock victim,
+// or ErrLockTimeout if the lock wasn't granted in time.
+func (lt *LockTable) acquire(txnum int, blk file.BlockId, mode int) error {
+	var timer *time.Timer
+	lt.Lock()
+	defer lt.Unlock()
+	for {
+		l := lt.lock(blk)
+		blockers := l.blockers(txnum, mode)
+		if len(blockers) == 0 {
+			delete(lt.waiting, txnum)
+			if mode == X_LOCK {
+				delete(l.sharers, txnum)
+				l.writer = txnum
+			} else if l.writer != txnum {
+				l.sharers[txnum] = true
+			}
+			return nil
+		}
+
+		w, ok := lt.waiting[txnum]
+		if !ok {
+			w = &lockWait{blk: blk, mode: mode, abort: make(chan struct{})}
+			lt.waiting[txnum] = w
+		}
+		if cycle := lt.cycle(txnum); cycle != nil {
+			victim := youngest(cycle)
+			lt.abort(victim)
+			if victim == txnum {
+				return fmt.Errorf("transactions %v wait for each other: %w", cycle, ErrDeadlock)
+			}
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(lt.timeout)
+			defer timer.Stop()
+		}
+		released := l.released
+		timedOut := false
+		lt.Unlock()
+		select {
+		case <-released:
+		case <-w.abort:
+		case <-timer.C:
+			timedOut = true
+		}
+		lt.Lock()
+		// the transaction may have been chosen as a victim while the lock was released
+		if lt.waiting[txnum] != w {
+			return fmt.Errorf("transaction %d chosen as deadlock victim: %w", txnum, ErrDeadlock)
+		}
+		if timedOut {
+			delete(lt.waiting, txnum)
+			return fmt.Errorf("transaction %d waited %v for transactions %v: %w", txnum, lt.timeout, blockers, ErrLockTimeout)
+		}
+	}
+}
+
+// cycle returns the transactions of a cycle of the wait-for graph going through txnum,
+// starting with txnum, or nil if there is none.
+// A waiting transaction waits for the transactions holding the lock it requested.
+func (lt *LockTable) cycle(txnum int) []int {
+	visited := make(map[int]bool)
+	var path []int
+	var visit func(t int) bool
+	visit = func(t int) bool {
+		if t == txnum && len(path) > 0 {
+			return true
+		}
+		if visited[t] {
+			return false
+		}
+		visited[t] = true
+		w, ok := lt.waiting[t]
+		if !ok || lt.locks[w.blk] == nil {
+			return false
+		}
+		path = append(path, t)
+		for _, next := range lt.locks[w.blk].blockers(t, w.mode) {
+			if visit(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(txnum) {
+		return path
+	}
+	return nil
+}
+
+// abort fails the lock request of waiting transaction txnum with ErrDeadlock.
+func (lt *LockTable) abort(txnum int) {
+	close(lt.waiting[txnum].abort)
+	delete(lt.waiting, txnum)
+}
+
+// youngest returns the most recent transaction of txnums, the one that started last.
+func youngest(txnums []int) int {
+	victim := txnums[0]
+	for _, t := range txnums {
+		victim = max(victim, t)
+	}
+	return victim
+}
+
+// release releases the lock txnum holds on blk, waking up the transactions waiting for it.
+func (lt *LockTable) release(txnum int, blk file.BlockId) {
+	lt.Lock()
+	defer lt.Unlock()
+	l, ok := lt.locks[blk]
+	if !ok {
+		return
+	}
+	if l.writer == txnum {
+		l.writer = 0
+	}
+	delete(l.sharers, txnum)
+	close(l.released)
+	if l.writer == 0 && len(l.sharers) == 0 {
+		delete(lt.locks, blk)
+	} else {
+		l.released = make(chan struct{})
+	}
+}
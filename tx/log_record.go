@@ -1,12 +1,21 @@
 package tx
 
-import "github.com/CefBoud/CefDB/file"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CefBoud/CefDB/file"
+	"github.com/CefBoud/CefDB/log"
+)
 
 // LogRecord defines the interface for different types of log records.
 type LogRecord interface {
 	Op() int
 	TxNumber() int
-	Undo(tx Transaction)
+	// Undo reverts the change of the record, without logging it.
+	Undo(tx Transaction) error
+	// Redo applies the change of the record again, without logging it.
+	Redo(tx Transaction) error
 	String() string
 }
 
@@ -20,21 +29,35 @@ const (
 	SETSTRING  = 5
 )
 
-// // logRecordFactories maps log record types to their creation functions.
-// var logRecordFactories = map[int]LogRecordCreator{
-// 	CHECKPOINT: func(p *Page) LogRecord { return new(CheckpointRecord) },
-// 	START:      func(p *Page) LogRecord { return NewStartRecord(p) },
-// 	COMMIT:     func(p *Page) LogRecord { return NewCommitRecord(p) },
-// 	ROLLBACK:   func(p *Page) LogRecord { return NewRollbackRecord(p) },
-// 	SETINT:     func(p *Page) LogRecord { return NewSetIntRecord(p) },
-// 	SETSTRING:  func(p *Page) LogRecord { return NewSetStringRecord(p) },
-// }
+var opNames = []string{"CHECKPOINT", "START", "COMMIT", "ROLLBACK", "SETINT", "SETSTRING"}
+
+// OpName returns the name of the log record type op, e.g. "SETINT".
+func OpName(op int) string {
+	if op < 0 || op >= len(opNames) {
+		return fmt.Sprintf("UNKNOWN(%d)", op)
+	}
+	return opNames[op]
+}
+
+// ParseOp returns the log record type named name, ignoring case.
+func ParseOp(name string) (int, error) {
+	for op, n := range opNames {
+		if strings.EqualFold(n, name) {
+			return op, nil
+		}
+	}
+	return -1, fmt.Errorf("unknown log record type %q", name)
+}
 
 // CreateLogRecord interprets the bytes returned by the log iterator and
 // creates the corresponding LogRecord.
-func CreateLogRecord(bytes []byte) LogRecord {
+func CreateLogRecord(bytes []byte) (LogRecord, error) {
 	p := file.NewPageFromBytes(bytes)
-	switch p.GetInt(0) {
+	op, err := p.GetInt(0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding log record type: %w", err)
+	}
+	switch op {
 	case CHECKPOINT:
 		return NewCheckpointRecord(bytes)
 	case START:
@@ -48,6 +71,98 @@ func CreateLogRecord(bytes []byte) LogRecord {
 	case SETSTRING:
 		return NewSetStringRecord(bytes)
 	default:
-		return nil
+		return nil, fmt.Errorf("unknown log record type %v", op)
+	}
+}
+
+// recordReader decodes the fields of a log record in order.
+// The first decoding error is kept in err and makes all later reads no-ops.
+type recordReader struct {
+	p   *file.Page
+	pos int
+	err error
+}
+
+// newRecordReader returns a reader positioned after the record type.
+func newRecordReader(b []byte) *recordReader {
+	return &recordReader{p: file.NewPageFromBytes(b), pos: 4}
+}
+
+func (r *recordReader) int() int {
+	if r.err != nil {
+		return 0
+	}
+	var v int
+	v, r.err = r.p.GetInt(r.pos)
+	r.pos += 4
+	return v
+}
+
+func (r *recordReader) int64() int64 {
+	if r.err != nil {
+		return 0
+	}
+	var v int64
+	v, r.err = r.p.GetInt64(r.pos)
+	r.pos += 8
+	return v
+}
+
+// more returns true if the record has bytes left to decode.
+func (r *recordReader) more() bool {
+	return r.err == nil && r.pos < len(r.p.Contents())
+}
+
+func (r *recordReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	var s string
+	s, r.err = r.p.GetString(r.pos)
+	r.pos += file.MaxLength(len(s))
+	return s
+}
+
+// recordWriter encodes the fields of a log record in order.
+type recordWriter struct {
+	p   *file.Page
+	pos int
+	err error
+}
+
+// newRecordWriter returns a writer for a record of the given type and size,
+// not counting the 4 bytes of the type itself.
+func newRecordWriter(op int, size int) *recordWriter {
+	w := &recordWriter{p: file.NewPage(4 + size)}
+	w.int(op)
+	return w
+}
+
+func (w *recordWriter) int(v int) {
+	if w.err == nil {
+		w.err = w.p.SetInt(w.pos, v)
+		w.pos += 4
+	}
+}
+
+func (w *recordWriter) int64(v int64) {
+	if w.err == nil {
+		w.err = w.p.SetInt64(w.pos, v)
+		w.pos += 8
+	}
+}
+
+func (w *recordWriter) string(s string) {
+	if w.err == nil {
+		w.err = w.p.SetString(w.pos, s)
+		w.pos += file.MaxLength(len(s))
+	}
+}
+
+// appendTo appends the encoded record to the log, returning its LSN.
+func (w *recordWriter) appendTo(lm *log.LogMgr) (int, error) {
+	if w.err != nil {
+		return -1, fmt.Errorf("encoding log record: %w", w.err)
 	}
+	return lm.Append(w.p.Contents())
 }
@@ -2,6 +2,7 @@ package tx
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/CefBoud/CefDB/buffer"
 	"github.com/CefBoud/CefDB/log"
@@ -24,7 +25,9 @@ func NewRecoveryMgr(tx *Transaction, lm *log.LogMgr, bm *buffer.BufferMgr) *Reco
 }
 
 func (rm *RecoveryMgr) Commit() error {
-	rm.bm.FlushAll(rm.tx.txnum)
+	if err := rm.bm.FlushAll(rm.tx.txnum); err != nil {
+		return fmt.Errorf("Error flushing buffers of tx[%v]: %w", rm.tx.txnum, err)
+	}
 	lsn, err := WriteCommitRecordToLog(rm.lm, rm.tx.txnum)
 	if err != nil {
 		return fmt.Errorf("Error WriteCommitRecordToLog tx[%v]: %v ", rm.tx.txnum, err)
@@ -40,16 +43,24 @@ func (rm *RecoveryMgr) Rollback() error {
 		return fmt.Errorf("Error getting log iterator while running Rollback for tx[%v]: %v ", rm.tx.txnum, err)
 	}
 	for {
-		bytes := iter.NextRecord()
+		bytes, err := iter.NextRecord()
+		if err != nil {
+			return fmt.Errorf("Error reading log while running Rollback for tx[%v]: %w", rm.tx.txnum, err)
+		}
 		if bytes == nil {
 			break
 		}
-		r := CreateLogRecord(bytes)
+		r, err := CreateLogRecord(bytes)
+		if err != nil {
+			return fmt.Errorf("Error decoding log while running Rollback for tx[%v]: %w", rm.tx.txnum, err)
+		}
 		if r.TxNumber() == rm.tx.txnum {
 			if r.Op() == START {
 				break
 			}
-			r.Undo(*rm.tx)
+			if err := r.Undo(*rm.tx); err != nil {
+				return fmt.Errorf("Error undoing %v while running Rollback for tx[%v]: %w", r, rm.tx.txnum, err)
+			}
 		}
 	}
 	lsn, err := WriteRollbackRecordToLog(rm.lm, rm.tx.txnum)
@@ -62,47 +73,98 @@ func (rm *RecoveryMgr) Rollback() error {
 }
 
 func (rm *RecoveryMgr) SetInt(buff *buffer.Buffer, offset int, val int) (int, error) {
-	old := buff.Contents().GetInt(offset)
+	old, err := buff.Contents().GetInt(offset)
+	if err != nil {
+		return -1, err
+	}
 	return WriteSetIntRecordToLog(rm.lm, rm.tx.txnum, buff.Block(), offset, old, val)
 }
 
 func (rm *RecoveryMgr) SetString(buff *buffer.Buffer, offset int, val string) (int, error) {
-	old := buff.Contents().GetString(offset)
+	old, err := buff.Contents().GetString(offset)
+	if err != nil {
+		return -1, err
+	}
 	return WriteSetStringRecordToLog(rm.lm, rm.tx.txnum, buff.Block(), offset, old, val)
 }
 
-// Recover uncompleted transactions from the log
+// Recover uncompleted transactions from the log, redo the completed ones,
 // and then write a quiescent checkpoint record to the log and flush it.
-
+// Redoing makes recovery correct for data files that may be missing
+// committed changes, such as the files of an online backup.
+// Rolled back transactions are undone again since their undos are not logged
+// and may likewise be missing.
 func (rm *RecoveryMgr) Recover() error {
+	return rm.recover(true)
+}
+
+// RecoverFromBase recovers data files restored from a base backup using the whole log,
+// which may span several checkpoints written after the backup was taken.
+// It works like Recover, except that every record of the log is undone or redone.
+func (rm *RecoveryMgr) RecoverFromBase() error {
+	return rm.recover(false)
+}
+
+// recover undoes and redoes the records of the log, back to the last checkpoint
+// if toCheckpoint is true.
+// It stops at the first record that can't be undone or redone, without writing
+// a checkpoint: the log is kept so that recovery can be run again.
+func (rm *RecoveryMgr) recover(toCheckpoint bool) error {
 	iter, err := rm.lm.Iterator()
 	if err != nil {
 		return fmt.Errorf("Error getting log iterator while running Recover for: %v ", err)
 	}
-	finishedTransactions := make(map[int]bool)
+	committedTransactions := make(map[int]bool)
+	var committedRecords []LogRecord // most recent first
 	for {
-		// The loop stops when it encounters a CHECKPOINT record
-		bytes := iter.NextRecord()
+		// The loop stops when it encounters a CHECKPOINT record, if toCheckpoint is true
+		bytes, err := iter.NextRecord()
+		if err != nil {
+			return fmt.Errorf("Error reading log while running Recover: %w", err)
+		}
 		if bytes == nil {
 			break
 		}
-		r := CreateLogRecord(bytes)
+		r, err := CreateLogRecord(bytes)
+		if err != nil {
+			return fmt.Errorf("Error decoding log while running Recover: %w", err)
+		}
 		if r.Op() == CHECKPOINT {
-			break
-		} else if r.Op() == COMMIT || r.Op() == ROLLBACK {
-			finishedTransactions[r.TxNumber()] = true
-		} else if !finishedTransactions[r.TxNumber()] { // not finished
-			r.Undo(*rm.tx)
+			if toCheckpoint {
+				break
+			}
+			// every session starts with the checkpoint written by its recovery: the commits
+			// seen so far belong to later sessions, whose transaction numbers may repeat
+			// those of earlier ones in logs written before they were seeded from the log
+			clear(committedTransactions)
+		} else if r.Op() == COMMIT {
+			committedTransactions[r.TxNumber()] = true
+		} else if committedTransactions[r.TxNumber()] {
+			committedRecords = append(committedRecords, r)
+		} else if err := r.Undo(*rm.tx); err != nil { // not committed
+			return fmt.Errorf("Error undoing %v while running Recover: %w", r, err)
+		}
+	}
+	for i := len(committedRecords) - 1; i >= 0; i-- {
+		if err := committedRecords[i].Redo(*rm.tx); err != nil {
+			return fmt.Errorf("Error redoing %v while running Recover: %w", committedRecords[i], err)
 		}
 	}
 
 	// once we revert all unfinished tx, we flush buffers to disk and write CHECKPOINT log record
-	rm.bm.FlushAll(rm.tx.txnum)
-	lsn, err := WriteCheckpointRecordToLog(rm.lm)
+	if err := rm.bm.FlushAll(rm.tx.txnum); err != nil {
+		return fmt.Errorf("Error flushing buffers while running Recover: %w", err)
+	}
+	lsn, err := WriteCheckpointRecordToLog(rm.lm, int(atomic.LoadInt64(&nextTxNum)))
 	if err != nil {
 		return fmt.Errorf("Error WriteCheckpointRecordToLog tx[%v]: %v ", rm.tx.txnum, err)
-	} else {
-		rm.lm.Flush(lsn)
+	}
+	if err := rm.lm.Flush(lsn); err != nil {
+		return fmt.Errorf("Error flushing checkpoint record: %w", err)
+	}
+	// records before the checkpoint are no longer needed for recovery
+	if err := rm.lm.TruncateBefore(lsn); err != nil {
+		return fmt.Errorf("Error truncating log before checkpoint: %w", err)
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package tx
 import (
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/CefBoud/CefDB/buffer"
@@ -41,15 +42,22 @@ func TestRecoveryMgr(t *testing.T) {
 	tx1.Commit()
 
 	iter, _ := lm.Iterator()
-	record := CreateLogRecord(iter.NextRecord())
+	nextRecord := func() LogRecord {
+		bytes, err := iter.NextRecord()
+		assert.NoError(t, err)
+		record, err := CreateLogRecord(bytes)
+		assert.NoError(t, err)
+		return record
+	}
+	record := nextRecord()
 	assert.Equal(t, record.String(), "LogRecord{TxNum: 1, Op: COMMIT}")
 
-	record = CreateLogRecord(iter.NextRecord())
+	record = nextRecord()
 	assert.Equal(t, record.String(), "LogRecord{TxNum: 1, Op: SETSTRING, FileName: testfile, Blknum: 1, Offset: 100, OldVal: Yes!, NewVal: no!}")
-	record = CreateLogRecord(iter.NextRecord())
+	record = nextRecord()
 	assert.Equal(t, record.String(), "LogRecord{TxNum: 1, Op: SETINT, FileName: testfile, Blknum: 1, Offset: 40, OldVal: 1, NewVal: 2}")
 
-	record = CreateLogRecord(iter.NextRecord())
+	record = nextRecord()
 	assert.Equal(t, record.String(), "LogRecord{TxNum: 1, Op: START}")
 
 	// test recovery
@@ -85,3 +93,121 @@ func TestRecoveryMgr(t *testing.T) {
 	assert.Equal(t, "no!", sval)
 
 }
+
+func TestRecoverFromBaseAcrossSessions(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 256)
+	assert.NoError(t, err)
+	lm, err := log.NewLogMgr(fm, "testlogfile")
+	assert.NoError(t, err)
+	fm.Append("testsessions")
+	fm.Append("testsessions")
+	x := file.NewBlockId("testsessions", 0)
+	y := file.NewBlockId("testsessions", 1)
+
+	// transaction numbers restart with each session, unless they are seeded from the log
+	base := atomic.AddInt64(&nextTxNum, 1000)
+	restart := func() *buffer.BufferMgr {
+		atomic.StoreInt64(&nextTxNum, base)
+		return buffer.NewBufferMgr(fm, lm, 3)
+	}
+	get := func(bm *buffer.BufferMgr, blk *file.BlockId, offset int) int {
+		tx := NewTransaction(fm, lm, bm)
+		assert.NoError(t, tx.Pin(blk))
+		v, err := tx.GetInt(blk, offset)
+		assert.NoError(t, err)
+		tx.Commit()
+		return v
+	}
+
+	// session 1: the transaction crashes without committing
+	bm := restart()
+	tx1 := NewTransaction(fm, lm, bm)
+	assert.NoError(t, tx1.Pin(x))
+	assert.NoError(t, tx1.SetInt(x, 0, 99, true))
+	assert.NoError(t, bm.FlushAll(tx1.txnum))
+	tx1.concurMgr.Release()
+	tx1.Unpin(x)
+
+	// session 2: recovery undoes it, then a transaction with the same number commits
+	bm = restart()
+	atomic.StoreInt64(&nextTxNum, base+1)
+	recovery := NewTransaction(fm, lm, bm)
+	assert.NoError(t, recovery.Recover())
+	recovery.Commit()
+	assert.Equal(t, 0, get(bm, x, 0))
+
+	atomic.StoreInt64(&nextTxNum, base)
+	tx2 := NewTransaction(fm, lm, bm)
+	assert.Equal(t, tx1.txnum, tx2.txnum)
+	assert.NoError(t, tx2.Pin(y))
+	assert.NoError(t, tx2.SetInt(y, 40, 5, true))
+	tx2.Commit()
+
+	// recovery from the whole log doesn't take the crashed transaction for the committed one
+	bm = restart()
+	recovery = NewTransaction(fm, lm, bm)
+	assert.NoError(t, recovery.RecoverFromBase())
+	recovery.Commit()
+	assert.Equal(t, 0, get(bm, x, 0))
+	assert.Equal(t, 5, get(bm, y, 40))
+
+	// seeded from the log, transaction numbers keep increasing across sessions
+	atomic.StoreInt64(&nextTxNum, base)
+	assert.NoError(t, SeedTxNum(lm))
+	tx3 := NewTransaction(fm, lm, buffer.NewBufferMgr(fm, lm, 3))
+	assert.Greater(t, tx3.txnum, recovery.txnum)
+	tx3.Commit()
+}
+
+func TestRecoverStopsOnFailedRedo(t *testing.T) {
+	tempDir := filepath.Join(os.TempDir(), "TestRecoverStopsOnFailedRedo")
+	_ = os.RemoveAll(tempDir) // Clean any previous test data
+
+	fm, err := file.NewFileMgr(tempDir, 256, file.WithChecksums())
+	assert.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewLogMgr(fm, "testlogfile")
+	assert.NoError(t, err)
+	fm.Append("testfailedredo")
+	blk := file.NewBlockId("testfailedredo", 0)
+
+	tx1 := NewTransaction(fm, lm, buffer.NewBufferMgr(fm, lm, 3))
+	assert.NoError(t, tx1.Pin(blk))
+	assert.NoError(t, tx1.SetInt(blk, 0, 7, true))
+	tx1.Commit()
+
+	// the block is corrupted on disk: redoing the committed update fails
+	path := filepath.Join(tempDir, "testfailedredo")
+	raw, _ := os.ReadFile(path)
+	raw[0] ^= 0xff
+	assert.NoError(t, fm.CloseFile("testfailedredo"))
+	assert.NoError(t, os.WriteFile(path, raw, 0666))
+
+	recovery := NewTransaction(fm, lm, buffer.NewBufferMgr(fm, lm, 3))
+	assert.ErrorAs(t, recovery.Recover(), new(*file.CorruptBlockError))
+	lastOp := func() int {
+		iter, err := lm.Iterator()
+		assert.NoError(t, err)
+		b, err := iter.NextRecord()
+		assert.NoError(t, err)
+		r, err := CreateLogRecord(b)
+		assert.NoError(t, err)
+		return r.Op()
+	}
+	// no checkpoint was written, so a later recovery still sees the update
+	assert.NotEqual(t, CHECKPOINT, lastOp())
+
+	assert.NoError(t, fm.Write(blk, file.NewPage(fm.BlockSize())))
+	bm := buffer.NewBufferMgr(fm, lm, 3)
+	recovery = NewTransaction(fm, lm, bm)
+	assert.NoError(t, recovery.Recover())
+	assert.Equal(t, CHECKPOINT, lastOp())
+	recovery.Commit()
+
+	tx2 := NewTransaction(fm, lm, bm)
+	assert.NoError(t, tx2.Pin(blk))
+	v, err := tx2.GetInt(blk, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, v)
+	tx2.Commit()
+}
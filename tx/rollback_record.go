@@ -3,7 +3,6 @@ package tx
 import (
 	"fmt"
 
-	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/log"
 )
 
@@ -11,11 +10,15 @@ type RollbackRecord struct {
 	txNum int
 }
 
-func NewRollbackRecord(b []byte) *RollbackRecord {
-	p := file.NewPageFromBytes(b)
-	return &RollbackRecord{
-		txNum: p.GetInt(4),
+func NewRollbackRecord(b []byte) (*RollbackRecord, error) {
+	r := newRecordReader(b)
+	txNum := r.int()
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding ROLLBACK record: %w", r.err)
 	}
+	return &RollbackRecord{
+		txNum: txNum,
+	}, nil
 }
 
 func (r *RollbackRecord) String() string {
@@ -33,13 +36,13 @@ func (rr *RollbackRecord) TxNumber() int {
 	return rr.txNum
 }
 
-func (rr *RollbackRecord) Undo(tx Transaction) {}
+func (rr *RollbackRecord) Undo(tx Transaction) error { return nil }
+
+func (rr *RollbackRecord) Redo(tx Transaction) error { return nil }
 
 // WriteRollbackRecordToLog appends a ROLLBACK record to the log and return the LSN and error
 func WriteRollbackRecordToLog(lm *log.LogMgr, txnum int) (int, error) {
-	b := make([]byte, 8)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, ROLLBACK)
-	p.SetInt(4, txnum)
-	return lm.Append(p.Contents())
+	w := newRecordWriter(ROLLBACK, 4)
+	w.int(txnum)
+	return w.appendTo(lm)
 }
@@ -15,21 +15,24 @@ type SetIntRecord struct {
 	newVal int
 }
 
-func NewSetIntRecord(b []byte) *SetIntRecord {
-	p := file.NewPageFromBytes(b)
-	txNum := p.GetInt(4)
-	fileName := p.GetString(8)
-	blknum := p.GetInt(12 + len(fileName))
-	offset := p.GetInt(16 + len(fileName))
-	oldVal := p.GetInt(20 + len(fileName))
-	newVal := p.GetInt(24 + len(fileName))
+func NewSetIntRecord(b []byte) (*SetIntRecord, error) {
+	r := newRecordReader(b)
+	txNum := r.int()
+	fileName := r.string()
+	blknum := r.int()
+	offset := r.int()
+	oldVal := r.int()
+	newVal := r.int()
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding SETINT record: %w", r.err)
+	}
 	return &SetIntRecord{
 		txNum:  txNum,
 		blk:    &file.BlockId{Filename: fileName, Blknum: blknum},
 		offset: offset,
 		oldVal: oldVal,
 		newVal: newVal,
-	}
+	}, nil
 }
 
 func (r *SetIntRecord) String() string {
@@ -52,23 +55,82 @@ func (r *SetIntRecord) TxNumber() int {
 	return r.txNum
 }
 
-func (r *SetIntRecord) Undo(tx Transaction) {
-	tx.Pin(r.blk)
-	tx.SetInt(r.blk, r.offset, r.oldVal, false) // do not log Undo :)
-	tx.Unpin(r.blk)
+// Block returns the block that was modified.
+func (r *SetIntRecord) Block() *file.BlockId {
+	return r.blk
+}
+
+// Offset returns the offset of the modified value in the block.
+func (r *SetIntRecord) Offset() int {
+	return r.offset
+}
+
+// OldVal returns the value before the modification.
+func (r *SetIntRecord) OldVal() int {
+	return r.oldVal
+}
+
+// NewVal returns the value after the modification.
+func (r *SetIntRecord) NewVal() int {
+	return r.newVal
+}
+
+func (r *SetIntRecord) Undo(tx Transaction) error {
+	if err := tx.pin(r.blk, nil); err != nil {
+		return err
+	}
+	defer tx.Unpin(r.blk)
+	if err := tx.SetInt(r.blk, r.offset, r.oldVal, false); err != nil { // do not log Undo :)
+		return err
+	}
+	return restoredInt(&tx, r.blk, r.offset, r.oldVal)
+}
+
+func (r *SetIntRecord) Redo(tx Transaction) error {
+	if err := tx.extendTo(r.blk); err != nil {
+		return err
+	}
+	if err := tx.pin(r.blk, nil); err != nil {
+		return err
+	}
+	defer tx.Unpin(r.blk)
+	if err := tx.SetInt(r.blk, r.offset, r.newVal, false); err != nil {
+		return err
+	}
+	return restoredInt(&tx, r.blk, r.offset, r.newVal)
+}
+
+// RestoredIntHook is called when undoing or redoing a SETINT record, during rollback
+// and recovery, wrote val at offset of blk. The block is pinned by tx.
+type RestoredIntHook func(tx *Transaction, blk *file.BlockId, offset int, val int) error
+
+var restoredIntHooks []RestoredIntHook
+
+// OnRestoredInt registers hook to be called for every integer written by undoing or
+// redoing a log record. It lets the structures derived from the data without being logged,
+// such as free-space maps, follow the changes of rollback and recovery.
+// Hooks should be registered when the program starts, before transactions run.
+func OnRestoredInt(hook RestoredIntHook) {
+	restoredIntHooks = append(restoredIntHooks, hook)
+}
+
+func restoredInt(tx *Transaction, blk *file.BlockId, offset int, val int) error {
+	for _, hook := range restoredIntHooks {
+		if err := hook(tx, blk, offset, val); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // WriteSetIntRecordToLog appends a setint record to the log and return the LSN and error
 func WriteSetIntRecordToLog(lm *log.LogMgr, txnum int, blk *file.BlockId, offset int, oldVal int, newVal int) (int, error) {
-	b := make([]byte, len(blk.Filename)+28)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, SETINT)
-	p.SetInt(4, txnum)
-	p.SetString(8, blk.Filename)
-	p.SetInt(12+len(blk.Filename), blk.Blknum)
-	pos := 16 + len(blk.Filename)
-	p.SetInt(pos, offset)
-	p.SetInt(pos+4, oldVal)
-	p.SetInt(pos+8, newVal)
-	return lm.Append(p.Contents())
+	w := newRecordWriter(SETINT, 4+file.MaxLength(len(blk.Filename))+16)
+	w.int(txnum)
+	w.string(blk.Filename)
+	w.int(blk.Blknum)
+	w.int(offset)
+	w.int(oldVal)
+	w.int(newVal)
+	return w.appendTo(lm)
 }
@@ -15,21 +15,24 @@ type SetStringRecord struct {
 	newVal string
 }
 
-func NewSetStringRecord(b []byte) *SetStringRecord {
-	p := file.NewPageFromBytes(b)
-	txNum := p.GetInt(4)
-	fileName := p.GetString(8)
-	blknum := p.GetInt(12 + len(fileName))
-	offset := p.GetInt(16 + len(fileName))
-	oldVal := p.GetString(20 + len(fileName))
-	newVal := p.GetString(24 + len(fileName) + len(oldVal))
+func NewSetStringRecord(b []byte) (*SetStringRecord, error) {
+	r := newRecordReader(b)
+	txNum := r.int()
+	fileName := r.string()
+	blknum := r.int()
+	offset := r.int()
+	oldVal := r.string()
+	newVal := r.string()
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding SETSTRING record: %w", r.err)
+	}
 	return &SetStringRecord{
 		txNum:  txNum,
 		blk:    &file.BlockId{Filename: fileName, Blknum: blknum},
 		offset: offset,
 		oldVal: oldVal,
 		newVal: newVal,
-	}
+	}, nil
 }
 
 func (r *SetStringRecord) String() string {
@@ -52,23 +55,53 @@ func (r *SetStringRecord) TxNumber() int {
 	return r.txNum
 }
 
-func (r *SetStringRecord) Undo(tx Transaction) {
-	tx.Pin(r.blk)
-	tx.SetString(r.blk, r.offset, r.oldVal, false) // do not log Undo :)
-	tx.Unpin(r.blk)
+// Block returns the block that was modified.
+func (r *SetStringRecord) Block() *file.BlockId {
+	return r.blk
+}
+
+// Offset returns the offset of the modified value in the block.
+func (r *SetStringRecord) Offset() int {
+	return r.offset
+}
+
+// OldVal returns the value before the modification.
+func (r *SetStringRecord) OldVal() string {
+	return r.oldVal
+}
+
+// NewVal returns the value after the modification.
+func (r *SetStringRecord) NewVal() string {
+	return r.newVal
+}
+
+func (r *SetStringRecord) Undo(tx Transaction) error {
+	if err := tx.pin(r.blk, nil); err != nil {
+		return err
+	}
+	defer tx.Unpin(r.blk)
+	return tx.SetString(r.blk, r.offset, r.oldVal, false) // do not log Undo :)
+}
+
+func (r *SetStringRecord) Redo(tx Transaction) error {
+	if err := tx.extendTo(r.blk); err != nil {
+		return err
+	}
+	if err := tx.pin(r.blk, nil); err != nil {
+		return err
+	}
+	defer tx.Unpin(r.blk)
+	return tx.SetString(r.blk, r.offset, r.newVal, false)
 }
 
 // WriteSetStringRecordToLog appends a setstring record to the log and return the LSN and error
 func WriteSetStringRecordToLog(lm *log.LogMgr, txnum int, blk *file.BlockId, offset int, oldVal string, newVal string) (int, error) {
-	b := make([]byte, len(blk.Filename)+len(oldVal)+len(newVal)+28)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, SETSTRING)
-	p.SetInt(4, txnum)
-	p.SetString(8, blk.Filename)
-	p.SetInt(12+len(blk.Filename), blk.Blknum)
-
-	p.SetInt(16+len(blk.Filename), offset)
-	p.SetString(20+len(blk.Filename), oldVal)
-	p.SetString(24+len(blk.Filename)+len(oldVal), newVal)
-	return lm.Append(p.Contents())
+	w := newRecordWriter(SETSTRING, 4+file.MaxLength(len(blk.Filename))+8+file.MaxLength(len(oldVal))+file.MaxLength(len(newVal)))
+	w.int(txnum)
+	w.string(blk.Filename)
+	w.int(blk.Blknum)
+	w.int(offset)
+	w.string(oldVal)
+	w.string(newVal)
+	return w.appendTo(lm)
 }
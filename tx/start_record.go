@@ -3,7 +3,6 @@ package tx
 import (
 	"fmt"
 
-	"github.com/CefBoud/CefDB/file"
 	"github.com/CefBoud/CefDB/log"
 )
 
@@ -11,11 +10,15 @@ type StartRecord struct {
 	txNum int
 }
 
-func NewStartRecord(b []byte) *StartRecord {
-	p := file.NewPageFromBytes(b)
-	return &StartRecord{
-		txNum: p.GetInt(4),
+func NewStartRecord(b []byte) (*StartRecord, error) {
+	r := newRecordReader(b)
+	txNum := r.int()
+	if r.err != nil {
+		return nil, fmt.Errorf("decoding START record: %w", r.err)
 	}
+	return &StartRecord{
+		txNum: txNum,
+	}, nil
 }
 
 func (r *StartRecord) String() string {
@@ -33,13 +36,13 @@ func (sr *StartRecord) TxNumber() int {
 	return sr.txNum
 }
 
-func (sr *StartRecord) Undo(tx Transaction) {}
+func (sr *StartRecord) Undo(tx Transaction) error { return nil }
+
+func (sr *StartRecord) Redo(tx Transaction) error { return nil }
 
 // WriteStartRecordToLog appends a start record to the log and return the LSN and error
 func WriteStartRecordToLog(lm *log.LogMgr, txnum int) (int, error) {
-	b := make([]byte, 8)
-	p := file.NewPageFromBytes(b)
-	p.SetInt(0, START)
-	p.SetInt(4, txnum)
-	return lm.Append(p.Contents())
+	w := newRecordWriter(START, 4)
+	w.int(txnum)
+	return w.appendTo(lm)
 }
@@ -1,8 +1,10 @@
 package tx
 
 import (
+	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/CefBoud/CefDB/buffer"
 	"github.com/CefBoud/CefDB/file"
@@ -19,10 +21,52 @@ type Transaction struct {
 	txnum       int
 	mybuffers   map[file.BlockId]*buffer.Buffer
 	myPins      map[file.BlockId]int
+	pinTimeout  time.Duration // 0 to use the timeout of the buffer manager
+	maxPins     int           // 0 for no limit
 }
 
+// ErrTooManyPins is returned when a transaction pins more buffers than it is allowed to.
+var ErrTooManyPins = errors.New("too many pinned buffers")
+
+// nextTxNum is the last transaction number handed out.
 var nextTxNum int64
 
+// SeedTxNum makes the transaction numbers handed out next follow those of the log,
+// so that they keep increasing across sessions. The log is read back to its last
+// checkpoint, which holds the last transaction number when it was written.
+// It should be called when a database is opened, before its transactions start.
+func SeedTxNum(lm *log.LogMgr) error {
+	iter, err := lm.Iterator()
+	if err != nil {
+		return fmt.Errorf("reading log to seed transaction numbers: %w", err)
+	}
+	last := 0
+	for {
+		bytes, err := iter.NextRecord()
+		if err != nil {
+			return fmt.Errorf("reading log to seed transaction numbers: %w", err)
+		}
+		if bytes == nil {
+			break
+		}
+		r, err := CreateLogRecord(bytes)
+		if err != nil {
+			return fmt.Errorf("decoding log to seed transaction numbers: %w", err)
+		}
+		if cp, ok := r.(*CheckpointRecord); ok {
+			last = max(last, cp.LastTxNum())
+			break
+		}
+		last = max(last, r.TxNumber())
+	}
+	for {
+		current := atomic.LoadInt64(&nextTxNum)
+		if current >= int64(last) || atomic.CompareAndSwapInt64(&nextTxNum, current, int64(last)) {
+			return nil
+		}
+	}
+}
+
 // This is a dummy block number to lock the EOF
 // the goal is to ensure serializability by avoiding phantoms (unaccounted for appends)
 const endOfFile = -1
@@ -33,15 +77,21 @@ const endOfFile = -1
 // managers that it gets from the class
 // simpledb.server.SimpleDB (not directly represented here).
 // Those objects are assumed to be initialized elsewhere.
+// Its locks are granted by a lock table shared by the transactions created by NewTransaction.
 func NewTransaction(fm *file.FileMgr, lm *log.LogMgr, bm *buffer.BufferMgr) *Transaction {
+	return NewTransactionWithLocks(fm, lm, bm, locks)
+}
 
+// NewTransactionWithLocks is like NewTransaction, but its locks are granted by the given lock table,
+// which must be the one of every transaction of the database.
+func NewTransactionWithLocks(fm *file.FileMgr, lm *log.LogMgr, bm *buffer.BufferMgr, locks *LockTable) *Transaction {
 	txnum := atomic.AddInt64(&nextTxNum, 1)
 
 	tx := &Transaction{
 		fm:        fm,
 		bm:        bm,
 		txnum:     int(txnum),
-		concurMgr: NewConcurrencyMgr(),
+		concurMgr: NewConcurrencyMgr(int(txnum), locks),
 		mybuffers: make(map[file.BlockId]*buffer.Buffer),
 		myPins:    make(map[file.BlockId]int),
 	}
@@ -66,11 +116,18 @@ func (tx *Transaction) Commit() {
 // flush those buffers,
 // write and flush a rollback record to the log,
 // release all locks, and unpin any pinned buffers.
-func (tx *Transaction) Rollback() {
-	tx.recoveryMgr.Rollback()
+// If a value can't be undone, the error is returned and the transaction keeps
+// its locks, so that no other transaction sees its changes: they are undone
+// by the recovery of the database.
+func (tx *Transaction) Rollback() error {
+	if err := tx.recoveryMgr.Rollback(); err != nil {
+		tx.UnpinAll()
+		return fmt.Errorf("rolling back transaction %d: %w", tx.txnum, err)
+	}
 	// fmt.Printf("transaction %d rolled back\n", tx.txnum)
 	tx.concurMgr.Release()
 	tx.UnpinAll()
+	return nil
 }
 
 // Unpin any buffers still pinned by this transaction.
@@ -82,21 +139,70 @@ func (tx *Transaction) UnpinAll() {
 
 // Recover flushes all modified buffers.
 // Then go through the log, rolling back all
-// uncommitted transactions. Finally,
+// uncommitted transactions and redoing the
+// committed ones. Finally,
 // write a quiescent checkpoint record to the log.
 // This method is called during system startup,
 // before user transactions begin.
-func (tx *Transaction) Recover() {
-	tx.bm.FlushAll(tx.txnum)
-	tx.recoveryMgr.Recover()
+func (tx *Transaction) Recover() error {
+	if err := tx.bm.FlushAll(tx.txnum); err != nil {
+		return err
+	}
+	return tx.recoveryMgr.Recover()
+}
+
+// RecoverFromBase is like Recover, but goes through the whole log
+// rather than stopping at the last checkpoint.
+// It is used to recover a base backup with the log archived after it.
+func (tx *Transaction) RecoverFromBase() error {
+	if err := tx.bm.FlushAll(tx.txnum); err != nil {
+		return err
+	}
+	return tx.recoveryMgr.RecoverFromBase()
+}
+
+// SetPinTimeout sets how long Pin waits for a buffer to become available,
+// overriding the timeout of the buffer manager.
+func (tx *Transaction) SetPinTimeout(timeout time.Duration) {
+	tx.pinTimeout = timeout
+}
+
+// SetMaxPins limits the number of buffers the transaction can pin at once.
+// 0 removes the limit.
+func (tx *Transaction) SetMaxPins(n int) {
+	tx.maxPins = n
 }
 
 // Pin the specified block.
 // The transaction manages the buffer for the client.
+// If no buffer becomes available in time, the returned error wraps buffer.ErrBufferAbort:
+// the transaction should then be rolled back, and can be retried.
+// If the transaction would pin more buffers than allowed by SetMaxPins,
+// the returned error wraps ErrTooManyPins.
 func (tx *Transaction) Pin(blk *file.BlockId) error {
-	buff := tx.bm.Pin(blk)
-	if buff == nil {
-		return fmt.Errorf("transaction failed to pin block %v ", blk)
+	return tx.PinInRing(blk, nil)
+}
+
+// PinInRing is like Pin, but reads the block into a buffer of ring if it isn't in the pool.
+func (tx *Transaction) PinInRing(blk *file.BlockId, ring *buffer.Ring) error {
+	if _, ok := tx.mybuffers[*blk]; !ok && tx.maxPins > 0 && len(tx.mybuffers) >= tx.maxPins {
+		return fmt.Errorf("transaction %d failed to pin block %v: it has %d pinned buffers: %w",
+			tx.txnum, blk, len(tx.mybuffers), ErrTooManyPins)
+	}
+	return tx.pin(blk, ring)
+}
+
+// pin is PinInRing without the limit set by SetMaxPins.
+// Log records are undone and redone with it: a transaction that reached
+// its limit must still be able to roll back.
+func (tx *Transaction) pin(blk *file.BlockId, ring *buffer.Ring) error {
+	timeout := tx.pinTimeout
+	if timeout <= 0 {
+		timeout = tx.bm.PinTimeout()
+	}
+	buff, err := tx.bm.PinInRing(blk, ring, timeout)
+	if err != nil {
+		return fmt.Errorf("transaction %d failed to pin block %v: %w", tx.txnum, blk, err)
 	}
 	tx.myPins[*blk]++
 	tx.mybuffers[*blk] = buff
@@ -121,19 +227,30 @@ func (tx *Transaction) Unpin(blk *file.BlockId) {
 
 }
 
+// pinnedBuffer returns the buffer the transaction pinned blk to.
+func (tx *Transaction) pinnedBuffer(blk *file.BlockId) (*buffer.Buffer, error) {
+	buff, ok := tx.mybuffers[*blk]
+	if !ok {
+		return nil, fmt.Errorf("transaction %d: block %v is not pinned", tx.txnum, blk)
+	}
+	return buff, nil
+}
+
 // GetInt returns the integer value stored at the
 // specified offset of the specified block.
 // The method first obtains an SLock on the block,
 // then it calls the buffer to retrieve the value.
+// If the lock can't be granted, the returned error wraps ErrDeadlock or ErrLockTimeout:
+// the transaction should then be rolled back.
 func (tx *Transaction) GetInt(blk *file.BlockId, offset int) (int, error) {
-	ok := tx.concurMgr.SLock(blk)
-	// fmt.Printf("tx %v trying to Slock blk %v.  success: %v \n", tx.txnum, blk, ok)
-	if !ok {
-		return 0, fmt.Errorf("unable to acquire Slock for %v", blk)
+	if err := tx.concurMgr.SLock(blk); err != nil {
+		return 0, fmt.Errorf("unable to acquire Slock for %v: %w", blk, err)
 	}
-
-	buff := tx.mybuffers[*blk]
-	return buff.Contents().GetInt(offset), nil
+	buff, err := tx.pinnedBuffer(blk)
+	if err != nil {
+		return 0, err
+	}
+	return buff.Contents().GetInt(offset)
 }
 
 // GetString returns the string value stored at the
@@ -141,13 +258,14 @@ func (tx *Transaction) GetInt(blk *file.BlockId, offset int) (int, error) {
 // The method first obtains an SLock on the block,
 // then it calls the buffer to retrieve the value.
 func (tx *Transaction) GetString(blk *file.BlockId, offset int) (string, error) {
-	tx.concurMgr.SLock(blk)
-	ok := tx.concurMgr.SLock(blk)
-	if !ok {
-		return "", fmt.Errorf("unable to acquire Slock for %v", blk)
+	if err := tx.concurMgr.SLock(blk); err != nil {
+		return "", fmt.Errorf("unable to acquire Slock for %v: %w", blk, err)
 	}
-	buff := tx.mybuffers[*blk]
-	return buff.Contents().GetString(offset), nil
+	buff, err := tx.pinnedBuffer(blk)
+	if err != nil {
+		return "", err
+	}
+	return buff.Contents().GetString(offset)
 }
 
 // SetInt stores an integer at the specified offset
@@ -159,15 +277,14 @@ func (tx *Transaction) GetString(blk *file.BlockId, offset int) (string, error)
 // Finally, it calls the buffer to store the value,
 // passing in the LSN of the log record and the transaction's id.
 func (tx *Transaction) SetInt(blk *file.BlockId, offset int, val int, okToLog bool) error {
-	ok := tx.concurMgr.XLock(blk)
-	// fmt.Printf("tx %v trying to Xlock blk %v.  success: %v \n", tx.txnum, blk, ok)
-
-	if !ok {
-		return fmt.Errorf("unable to acquire Xlock for %v", blk)
+	if err := tx.concurMgr.XLock(blk); err != nil {
+		return fmt.Errorf("unable to acquire Xlock for %v: %w", blk, err)
+	}
+	buff, err := tx.pinnedBuffer(blk)
+	if err != nil {
+		return err
 	}
-	buff := tx.mybuffers[*blk]
 	lsn := -1
-	var err error
 	if okToLog {
 		lsn, err = tx.recoveryMgr.SetInt(buff, offset, val)
 		if err != nil {
@@ -175,7 +292,9 @@ func (tx *Transaction) SetInt(blk *file.BlockId, offset int, val int, okToLog bo
 		}
 	}
 	p := buff.Contents()
-	p.SetInt(offset, val)
+	if err := p.SetInt(offset, val); err != nil {
+		return err
+	}
 	buff.SetModified(tx.txnum, lsn)
 	return nil
 }
@@ -189,13 +308,14 @@ func (tx *Transaction) SetInt(blk *file.BlockId, offset int, val int, okToLog bo
 // Finally, it calls the buffer to store the value,
 // passing in the LSN of the log record and the transaction's id.
 func (tx *Transaction) SetString(blk *file.BlockId, offset int, val string, okToLog bool) error {
-	ok := tx.concurMgr.XLock(blk)
-	if !ok {
-		return fmt.Errorf("unable to acquire Xlock for %v", blk)
+	if err := tx.concurMgr.XLock(blk); err != nil {
+		return fmt.Errorf("unable to acquire Xlock for %v: %w", blk, err)
+	}
+	buff, err := tx.pinnedBuffer(blk)
+	if err != nil {
+		return err
 	}
-	buff := tx.mybuffers[*blk]
 	lsn := -1
-	var err error
 	if okToLog {
 		lsn, err = tx.recoveryMgr.SetString(buff, offset, val)
 		if err != nil {
@@ -204,7 +324,9 @@ func (tx *Transaction) SetString(blk *file.BlockId, offset int, val string, okTo
 
 	}
 	p := buff.Contents()
-	p.SetString(offset, val)
+	if err := p.SetString(offset, val); err != nil {
+		return err
+	}
 	buff.SetModified(tx.txnum, lsn)
 	return nil
 }
@@ -215,9 +337,8 @@ func (tx *Transaction) SetString(blk *file.BlockId, offset int, val string, okTo
 // to return the file size.
 func (tx *Transaction) Size(filename string) (int, error) {
 	dummyblk := file.NewBlockId(filename, endOfFile)
-	ok := tx.concurMgr.SLock(dummyblk)
-	if !ok {
-		return 0, fmt.Errorf("unable to acquire Slock for %v", dummyblk)
+	if err := tx.concurMgr.SLock(dummyblk); err != nil {
+		return 0, fmt.Errorf("unable to acquire Slock for %v: %w", dummyblk, err)
 	}
 	return tx.fm.Length(filename)
 }
@@ -228,16 +349,45 @@ func (tx *Transaction) Size(filename string) (int, error) {
 // "end of the file", before performing the append.
 func (tx *Transaction) Append(filename string) (*file.BlockId, error) {
 	dummyblk := file.NewBlockId(filename, endOfFile)
-	tx.concurMgr.XLock(dummyblk)
-	ok := tx.concurMgr.XLock(dummyblk)
-	if !ok {
-		return nil, fmt.Errorf("unable to acquire Xlock for %v", dummyblk)
+	if err := tx.concurMgr.XLock(dummyblk); err != nil {
+		return nil, fmt.Errorf("unable to acquire Xlock for %v: %w", dummyblk, err)
 	}
 	blk, _ := tx.fm.Append(filename)
 	return blk, nil
 }
 
+// extendTo appends blocks to the file of blk until blk exists.
+// It is used by recovery to redo changes to blocks that were
+// appended after a backup copied the file.
+func (tx *Transaction) extendTo(blk *file.BlockId) error {
+	size, err := tx.Size(blk.Filename)
+	if err != nil {
+		return err
+	}
+	for ; size <= blk.Blknum; size++ {
+		if _, err := tx.Append(blk.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TxNum returns the number of the transaction.
+func (tx *Transaction) TxNum() int {
+	return tx.txnum
+}
+
 // BlockSize returns the block size used by the file manager.
 func (tx *Transaction) BlockSize() int {
 	return tx.fm.BlockSize()
 }
+
+// BufferMgr returns the buffer manager the transaction pins its blocks with.
+func (tx *Transaction) BufferMgr() *buffer.BufferMgr {
+	return tx.bm
+}
+
+// FileMgr returns the file manager of the transaction's database.
+func (tx *Transaction) FileMgr() *file.FileMgr {
+	return tx.fm
+}
@@ -64,6 +64,7 @@ func TestTxBasic(t *testing.T) {
 	assert.NoError(t, tx3.Pin(blk))
 	_, err = tx3.GetInt(blk, 80)
 	assert.Contains(t, err.Error(), "unable to acquire")
+	assert.ErrorIs(t, err, ErrLockTimeout)
 	tx3.Rollback()
 	tx2.Commit()
 
@@ -154,3 +155,166 @@ func TestTxBasic(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestTxPinTimeout(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	assert.NoError(t, err)
+	lm, err := log.NewLogMgr(fm, "testlogfiletx")
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		fm.Append("testpintimeout")
+	}
+	bm := buffer.NewBufferMgr(fm, lm, 1, buffer.WithPinTimeout(time.Hour))
+
+	tx1 := NewTransaction(fm, lm, bm)
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testpintimeout", 0)))
+
+	// the transaction's timeout overrides the buffer manager's
+	tx2 := NewTransaction(fm, lm, bm)
+	tx2.SetPinTimeout(10 * time.Millisecond)
+	err = tx2.Pin(file.NewBlockId("testpintimeout", 1))
+	assert.ErrorIs(t, err, buffer.ErrBufferAbort)
+	tx2.Rollback()
+
+	// a waiting transaction is woken up once the buffer is unpinned
+	tx3 := NewTransaction(fm, lm, bm)
+	pinned := make(chan error)
+	go func() { pinned <- tx3.Pin(file.NewBlockId("testpintimeout", 1)) }()
+	time.Sleep(10 * time.Millisecond)
+	tx1.Commit()
+	select {
+	case err := <-pinned:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiting transaction wasn't woken up")
+	}
+	tx3.Commit()
+}
+
+func TestTxMaxPins(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	assert.NoError(t, err)
+	lm, err := log.NewLogMgr(fm, "testlogfiletx")
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		fm.Append("testmaxpins")
+	}
+	bm := buffer.NewBufferMgr(fm, lm, 3)
+
+	tx1 := NewTransaction(fm, lm, bm)
+	tx1.SetMaxPins(2)
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpins", 0)))
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpins", 1)))
+	// pinning a block again doesn't take another buffer
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpins", 1)))
+	err = tx1.Pin(file.NewBlockId("testmaxpins", 2))
+	assert.ErrorIs(t, err, ErrTooManyPins)
+	assert.Equal(t, 1, bm.Available())
+
+	tx1.Unpin(file.NewBlockId("testmaxpins", 0))
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpins", 2)))
+	tx1.Commit()
+}
+
+func TestTxMaxPinsRollback(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	assert.NoError(t, err)
+	lm, err := log.NewLogMgr(fm, "testlogfiletx")
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		fm.Append("testmaxpinsrollback")
+	}
+	bm := buffer.NewBufferMgr(fm, lm, 3)
+	blk0 := file.NewBlockId("testmaxpinsrollback", 0)
+
+	// the transaction modifies a block it then unpins, and reaches its limit
+	tx1 := NewTransaction(fm, lm, bm)
+	tx1.SetMaxPins(2)
+	assert.NoError(t, tx1.Pin(blk0))
+	assert.NoError(t, tx1.SetInt(blk0, 0, 42, true))
+	tx1.Unpin(blk0)
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpinsrollback", 1)))
+	assert.NoError(t, tx1.Pin(file.NewBlockId("testmaxpinsrollback", 2)))
+	assert.ErrorIs(t, tx1.Pin(blk0), ErrTooManyPins)
+	// a block that isn't pinned can't be read or written
+	assert.Error(t, tx1.SetInt(blk0, 0, 43, true))
+	tx1.Rollback()
+
+	tx2 := NewTransaction(fm, lm, bm)
+	assert.NoError(t, tx2.Pin(blk0))
+	v, err := tx2.GetInt(blk0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, v)
+	tx2.Commit()
+}
+
+func TestTxDeadlock(t *testing.T) {
+	fm, err := file.NewFileMgrWithStorage(file.NewMemStorage(), 128)
+	assert.NoError(t, err)
+	lm, err := log.NewLogMgr(fm, "testlogfiletx")
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		fm.Append("testdeadlock")
+	}
+	bm := buffer.NewBufferMgr(fm, lm, 4)
+	blk0 := file.NewBlockId("testdeadlock", 0)
+	blk1 := file.NewBlockId("testdeadlock", 1)
+
+	// lock blk0 for older and blk1 for younger
+	start := func() (older, younger *Transaction) {
+		older = NewTransaction(fm, lm, bm)
+		younger = NewTransaction(fm, lm, bm)
+		for _, tx := range []*Transaction{older, younger} {
+			assert.NoError(t, tx.Pin(blk0))
+			assert.NoError(t, tx.Pin(blk1))
+		}
+		assert.NoError(t, older.SetInt(blk0, 0, 1, true))
+		assert.NoError(t, younger.SetInt(blk1, 0, 1, true))
+		return older, younger
+	}
+
+	// the younger transaction completes the cycle: its request fails right away
+	older, younger := start()
+	olderErr := make(chan error)
+	go func() { olderErr <- older.SetInt(blk1, 0, 2, true) }()
+	time.Sleep(50 * time.Millisecond)
+	began := time.Now()
+	err = younger.SetInt(blk0, 0, 2, true)
+	assert.ErrorIs(t, err, ErrDeadlock)
+	assert.Contains(t, err.Error(), "unable to acquire")
+	assert.Less(t, time.Since(began), MAX_TIME/2)
+	younger.Rollback()
+	assert.NoError(t, <-olderErr)
+	older.Commit()
+
+	// the older transaction completes the cycle: the waiting younger one is the victim
+	older, younger = start()
+	youngerErr := make(chan error)
+	go func() { youngerErr <- younger.SetInt(blk0, 0, 2, true) }()
+	time.Sleep(50 * time.Millisecond)
+	go func() { olderErr <- older.SetInt(blk1, 0, 2, true) }()
+	select {
+	case err := <-youngerErr:
+		assert.ErrorIs(t, err, ErrDeadlock)
+	case err := <-olderErr:
+		t.Fatalf("older transaction was chosen as the victim: %v", err)
+	}
+	younger.Rollback()
+	assert.NoError(t, <-olderErr)
+	older.Commit()
+
+	// two transactions upgrading their shared lock
+	older = NewTransaction(fm, lm, bm)
+	younger = NewTransaction(fm, lm, bm)
+	for _, tx := range []*Transaction{older, younger} {
+		assert.NoError(t, tx.Pin(blk0))
+		_, err := tx.GetInt(blk0, 0)
+		assert.NoError(t, err)
+	}
+	go func() { olderErr <- older.SetInt(blk0, 0, 3, true) }()
+	time.Sleep(50 * time.Millisecond)
+	assert.ErrorIs(t, younger.SetInt(blk0, 0, 4, true), ErrDeadlock)
+	younger.Rollback()
+	assert.NoError(t, <-olderErr)
+	older.Commit()
+}